@@ -0,0 +1,242 @@
+package agd
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// DDR Template Builder
+
+// DDRProtoConfig is the declarative configuration of a single DDR-advertised
+// resolver protocol, used to materialize a [dns.SVCB] or [dns.HTTPS] record
+// without hand-crafting one.
+type DDRProtoConfig struct {
+	// ALPN is the protocol's ALPN identifier, e.g. "dot", "doh", "doh2",
+	// "h3", or "doq".
+	ALPN string
+
+	// DoHPath is the DoH path template, as defined by RFC 9461, e.g.
+	// "/dns-query{?dns}".  It is only added for ALPN values that use HTTP
+	// (i.e. "doh", "doh2", and "h3").  The literal substring "{id}", if
+	// present, is replaced with the detected device ID by
+	// [DDR.ExpandTemplate].
+	DoHPath string
+
+	// Port overrides the default port for the protocol.  If zero, the
+	// protocol's IANA-assigned default port is used.
+	Port uint16
+
+	// IPv4Hints are the IPv4 address hints to advertise for the protocol.
+	IPv4Hints []netip.Addr
+
+	// IPv6Hints are the IPv6 address hints to advertise for the protocol.
+	IPv6Hints []netip.Addr
+}
+
+// DDRBuilderConfig is the configuration for [BuildDDRTemplates].
+type DDRBuilderConfig struct {
+	// Protocols are the resolver protocols to advertise.
+	Protocols []DDRProtoConfig
+
+	// DeviceTarget is the target domain name template used for
+	// device-specific records.  The literal substring "{id}", if present, is
+	// replaced with the detected device ID by [DDR.ExpandTemplate].
+	DeviceTarget string
+
+	// PublicTarget is the target domain name used for public, non-device
+	// records.
+	PublicTarget string
+
+	// Priority is the SVCB priority to set on every generated record.
+	Priority uint16
+}
+
+// defaultALPNPorts are the IANA-assigned default ports used when a
+// [DDRProtoConfig] does not set an explicit Port.
+var defaultALPNPorts = map[string]uint16{
+	"dot":  853,
+	"doq":  853,
+	"doh":  443,
+	"doh2": 443,
+	"h3":   443,
+}
+
+// httpALPNs are the ALPN identifiers of the HTTP-based resolver protocols
+// that must be advertised via an HTTPS (type 65) record rather than a plain
+// SVCB (type 64) one.
+//
+// See https://datatracker.ietf.org/doc/html/rfc9462#section-5.
+var httpALPNs = map[string]bool{
+	"doh":  true,
+	"doh2": true,
+	"h3":   true,
+}
+
+// BuildDDRTemplates materializes the device and public record templates
+// described by c.  Each returned template is a *[dns.SVCB] for the
+// non-HTTP-based protocols (e.g. "dot" and "doq") or a *[dns.HTTPS] for the
+// HTTP-based ones (e.g. "doh", "doh2", and "h3"), as required by RFC 9462.
+// The returned templates still contain the "{id}" placeholder, if any, and
+// must be passed through [DDR.ExpandTemplate] before being sent as part of a
+// response.
+func BuildDDRTemplates(c *DDRBuilderConfig) (device, public []dns.RR, err error) {
+	for i, p := range c.Protocols {
+		port := p.Port
+		if port == 0 {
+			var ok bool
+			port, ok = defaultALPNPorts[p.ALPN]
+			if !ok {
+				return nil, nil, fmt.Errorf("ddr: protocol %d: unknown alpn %q", i, p.ALPN)
+			}
+		}
+
+		proto := p
+		device = append(device, buildSVCB(c.DeviceTarget, c.Priority, port, &proto))
+		public = append(public, buildSVCB(c.PublicTarget, c.Priority, port, &proto))
+	}
+
+	return device, public, nil
+}
+
+// buildSVCB materializes a single DDR record for the given target and
+// protocol configuration, as either a *[dns.SVCB] or, for the HTTP-based
+// protocols, a real *[dns.HTTPS].
+func buildSVCB(target string, priority, port uint16, p *DDRProtoConfig) (rr dns.RR) {
+	kv := []dns.SVCBKeyValue{
+		&dns.SVCBAlpn{Alpn: []string{p.ALPN}},
+		&dns.SVCBPort{Port: port},
+	}
+
+	if p.DoHPath != "" && httpALPNs[p.ALPN] {
+		kv = append(kv, &dns.SVCBDoHPath{Template: p.DoHPath})
+	}
+
+	if len(p.IPv4Hints) > 0 {
+		kv = append(kv, &dns.SVCBIPv4Hint{Hint: toNetIPv4(p.IPv4Hints)})
+	}
+
+	if len(p.IPv6Hints) > 0 {
+		kv = append(kv, &dns.SVCBIPv6Hint{Hint: toNetIPv6(p.IPv6Hints)})
+	}
+
+	isHTTPS := httpALPNs[p.ALPN]
+
+	rrtype := dns.TypeSVCB
+	if isHTTPS {
+		rrtype = dns.TypeHTTPS
+	}
+
+	svcb := dns.SVCB{
+		Hdr: dns.RR_Header{
+			Rrtype: rrtype,
+			Class:  dns.ClassINET,
+		},
+		Priority: priority,
+		Target:   dns.Fqdn(target),
+		Value:    kv,
+	}
+
+	if isHTTPS {
+		return &dns.HTTPS{SVCB: svcb}
+	}
+
+	return &svcb
+}
+
+// svcbOf returns the embedded [dns.SVCB] of rr, which must be either a
+// *[dns.SVCB] or a *[dns.HTTPS], as materialized by [buildSVCB].  It returns
+// nil for any other, unexpected type.
+func svcbOf(rr dns.RR) (svcb *dns.SVCB) {
+	switch t := rr.(type) {
+	case *dns.SVCB:
+		return t
+	case *dns.HTTPS:
+		return &t.SVCB
+	default:
+		return nil
+	}
+}
+
+// ddrIDPlaceholder is the placeholder substring replaced with the detected
+// device ID in DDR templates built by [BuildDDRTemplates].
+const ddrIDPlaceholder = "{id}"
+
+// ExpandTemplate returns a copy of tmpl, which must be a *[dns.SVCB] or a
+// *[dns.HTTPS] as materialized by [BuildDDRTemplates], with
+// [ddrIDPlaceholder] replaced with id in both the record's target and, if
+// present, its DoH path template.
+func ExpandTemplate(tmpl dns.RR, id string) (rr dns.RR) {
+	rr = dns.Copy(tmpl)
+
+	svcb := svcbOf(rr)
+	svcb.Target = strings.ReplaceAll(svcb.Target, ddrIDPlaceholder, id)
+
+	for _, kv := range svcb.Value {
+		p, ok := kv.(*dns.SVCBDoHPath)
+		if ok {
+			p.Template = strings.ReplaceAll(p.Template, ddrIDPlaceholder, id)
+		}
+	}
+
+	return rr
+}
+
+// PickTemplates returns the DDR record templates from ddr that match the
+// client's negotiated transport, expressed as its ALPN identifier (e.g.
+// "doh", "h3", "doq").  isDevice selects between device-specific and public
+// templates.
+func (ddr *DDR) PickTemplates(alpn string, isDevice bool) (rrs []dns.RR) {
+	templates := ddr.PublicRecordTemplates
+	if isDevice {
+		templates = ddr.DeviceRecordTemplates
+	}
+
+	for _, t := range templates {
+		svcb := svcbOf(t)
+		for _, kv := range svcb.Value {
+			a, ok := kv.(*dns.SVCBAlpn)
+			if ok && containsString(a.Alpn, alpn) {
+				rrs = append(rrs, t)
+
+				break
+			}
+		}
+	}
+
+	return rrs
+}
+
+// containsString returns true if s is present in strs.
+func containsString(strs []string, s string) (ok bool) {
+	for _, v := range strs {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// toNetIPv4 converts addrs to the net.IP slice expected by
+// [dns.SVCBIPv4Hint].
+func toNetIPv4(addrs []netip.Addr) (ips []net.IP) {
+	for _, a := range addrs {
+		ips = append(ips, net.IP(a.AsSlice()))
+	}
+
+	return ips
+}
+
+// toNetIPv6 converts addrs to the net.IP slice expected by
+// [dns.SVCBIPv6Hint].
+func toNetIPv6(addrs []netip.Addr) (ips []net.IP) {
+	for _, a := range addrs {
+		ips = append(ips, net.IP(a.AsSlice()))
+	}
+
+	return ips
+}
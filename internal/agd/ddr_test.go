@@ -0,0 +1,105 @@
+package agd_test
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/agd"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBuildDDRTemplates makes sure that HTTP-based protocols are advertised
+// as real *[dns.HTTPS] records, and non-HTTP ones as *[dns.SVCB], since DDR
+// clients and the rest of the pipeline (see
+// [github.com/AdguardTeam/AdGuardDNS/internal/dnsmsg.Clone]) distinguish
+// between the two by concrete Go type, not just by RR type number.
+func TestBuildDDRTemplates(t *testing.T) {
+	c := &agd.DDRBuilderConfig{
+		Protocols: []agd.DDRProtoConfig{{
+			ALPN: "dot",
+		}, {
+			ALPN:    "doh",
+			DoHPath: "/dns-query{?dns}",
+		}},
+		DeviceTarget: "{id}.d.example.com",
+		PublicTarget: "dns.example.com",
+		Priority:     1,
+	}
+
+	device, public, err := agd.BuildDDRTemplates(c)
+	require.NoError(t, err)
+	require.Len(t, device, 2)
+	require.Len(t, public, 2)
+
+	_, ok := device[0].(*dns.SVCB)
+	assert.True(t, ok, "dot must be a plain SVCB record")
+
+	_, ok = device[0].(*dns.HTTPS)
+	assert.False(t, ok)
+
+	https, ok := device[1].(*dns.HTTPS)
+	assert.True(t, ok, "doh must be a real HTTPS record")
+
+	assert.Equal(t, uint16(dns.TypeHTTPS), https.Hdr.Rrtype)
+}
+
+// TestDDR_PickTemplates makes sure that PickTemplates matches templates by
+// ALPN regardless of whether the underlying template is a *[dns.SVCB] or a
+// *[dns.HTTPS].
+func TestDDR_PickTemplates(t *testing.T) {
+	c := &agd.DDRBuilderConfig{
+		Protocols: []agd.DDRProtoConfig{{
+			ALPN: "dot",
+		}, {
+			ALPN:    "h3",
+			DoHPath: "/dns-query{?dns}",
+		}},
+		DeviceTarget: "{id}.d.example.com",
+		PublicTarget: "dns.example.com",
+		Priority:     1,
+	}
+
+	_, public, err := agd.BuildDDRTemplates(c)
+	require.NoError(t, err)
+
+	ddr := &agd.DDR{
+		PublicRecordTemplates: public,
+	}
+
+	rrs := ddr.PickTemplates("h3", false)
+	require.Len(t, rrs, 1)
+
+	_, ok := rrs[0].(*dns.HTTPS)
+	assert.True(t, ok)
+
+	rrs = ddr.PickTemplates("dot", false)
+	require.Len(t, rrs, 1)
+
+	_, ok = rrs[0].(*dns.SVCB)
+	assert.True(t, ok)
+}
+
+// TestExpandTemplate makes sure that ExpandTemplate replaces the device-ID
+// placeholder in the target and preserves the template's concrete RR type.
+func TestExpandTemplate(t *testing.T) {
+	c := &agd.DDRBuilderConfig{
+		Protocols: []agd.DDRProtoConfig{{
+			ALPN:    "doh",
+			DoHPath: "/dns-query{?dns}",
+		}},
+		DeviceTarget: "{id}.d.example.com",
+		PublicTarget: "dns.example.com",
+		Priority:     1,
+	}
+
+	device, _, err := agd.BuildDDRTemplates(c)
+	require.NoError(t, err)
+	require.Len(t, device, 1)
+
+	rr := agd.ExpandTemplate(device[0], "abc123")
+	https, ok := rr.(*dns.HTTPS)
+	require.True(t, ok)
+
+	assert.Equal(t, "abc123.d.example.com.", https.Target)
+}
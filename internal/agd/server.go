@@ -60,12 +60,18 @@ type DDR struct {
 	PublicTargets *stringutil.Set
 
 	// DeviceRecordTemplates are used to respond to DDR queries from recognized
-	// devices.
-	DeviceRecordTemplates []*dns.SVCB
+	// devices.  Each element is either a *[dns.SVCB] or a *[dns.HTTPS],
+	// depending on the protocol it advertises.  They still contain the
+	// device-ID placeholder and must be passed through [ExpandTemplate]
+	// before use.  Use [BuildDDRTemplates] to materialize these from a
+	// declarative [DDRBuilderConfig] instead of hand-crafting them; use
+	// [DDR.PickTemplates] to select the ones that match a given query's
+	// transport.
+	DeviceRecordTemplates []dns.RR
 
 	// PubilcRecordTemplates are used to respond to DDR queries from
 	// unrecognized devices.
-	PublicRecordTemplates []*dns.SVCB
+	PublicRecordTemplates []dns.RR
 
 	// Enabled shows if DDR queries are processed.  If it is false, DDR domain
 	// name queries receive an NXDOMAIN response.
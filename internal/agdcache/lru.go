@@ -0,0 +1,121 @@
+// Package agdcache contains simple in-memory caching primitives shared by
+// other internal packages.
+package agdcache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU is a minimal, concurrency-safe least-recently-used cache.
+type LRU[K comparable, V any] struct {
+	mu    *sync.Mutex
+	size  int
+	items map[K]*list.Element
+	order *list.List
+}
+
+// entry is the value stored in an LRU's underlying list.
+type entry[K comparable, V any] struct {
+	key K
+	val V
+}
+
+// NewLRU returns a new *LRU that holds at most size entries.
+func NewLRU[K comparable, V any](size int) (c *LRU[K, V]) {
+	return &LRU[K, V]{
+		mu:    &sync.Mutex{},
+		size:  size,
+		items: map[K]*list.Element{},
+		order: list.New(),
+	}
+}
+
+// Get returns the value stored under key, if any, promoting it to most
+// recently used.  A zero-sized cache never returns anything.
+func (c *LRU[K, V]) Get(key K) (val V, ok bool) {
+	if c.size <= 0 {
+		return val, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return val, false
+	}
+
+	c.order.MoveToFront(el)
+
+	return el.Value.(*entry[K, V]).val, true
+}
+
+// Set stores val under key, evicting the least recently used entry if the
+// cache is at capacity.  A zero-sized cache never stores anything.
+func (c *LRU[K, V]) Set(key K, val V) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		el.Value.(*entry[K, V]).val = val
+		c.order.MoveToFront(el)
+
+		return
+	}
+
+	c.pushFront(key, val)
+}
+
+// GetOrStore returns the value stored under key, promoting it to most
+// recently used, or stores newVal and returns that instead if key isn't
+// present yet, evicting the least recently used entry if the cache is at
+// capacity.  A zero-sized cache never stores anything and always returns
+// newVal.
+func (c *LRU[K, V]) GetOrStore(key K, newVal V) (val V) {
+	if c.size <= 0 {
+		return newVal
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.order.MoveToFront(el)
+
+		return el.Value.(*entry[K, V]).val
+	}
+
+	c.pushFront(key, newVal)
+
+	return newVal
+}
+
+// Clear removes every entry from the cache.  It is used to invalidate the
+// cache after the underlying data has changed wholesale, e.g. after a reload.
+func (c *LRU[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = map[K]*list.Element{}
+	c.order.Init()
+}
+
+// pushFront adds a new entry for key and val, evicting the least recently
+// used one if the cache is at capacity.  c.mu must be held.
+func (c *LRU[K, V]) pushFront(key K, val V) {
+	el := c.order.PushFront(&entry[K, V]{key: key, val: val})
+	c.items[key] = el
+
+	if c.size > 0 && c.order.Len() > c.size {
+		oldest := c.order.Back()
+		if oldest != nil {
+			c.order.Remove(oldest)
+			delete(c.items, oldest.Value.(*entry[K, V]).key)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package cmd
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"math/rand"
 	"net"
 	"net/http"
 	"os"
@@ -11,13 +14,11 @@ import (
 	"github.com/AdguardTeam/AdGuardDNS/internal/agdhttp"
 	"github.com/AdguardTeam/AdGuardDNS/internal/debugsvc"
 	"github.com/AdguardTeam/AdGuardDNS/internal/dnsdb"
-	"github.com/AdguardTeam/AdGuardDNS/internal/errcoll"
 	"github.com/AdguardTeam/AdGuardDNS/internal/geoip"
 	"github.com/AdguardTeam/AdGuardDNS/internal/rulestat"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
 	env "github.com/caarlos0/env/v6"
-	"github.com/getsentry/raven-go"
 )
 
 // Environment Configuration
@@ -47,8 +48,26 @@ type environments struct {
 
 	ListenPort int `env:"LISTEN_PORT" envDefault:"8181"`
 
+	// HealthConf, PprofConf, PrometheusConf, and DNSDBConf let each debug
+	// endpoint be bound, guarded, and encrypted independently of the others;
+	// an endpoint whose ListenAddr and ListenPort are both unset shares
+	// ListenAddr and ListenPort above.
+	HealthConf     debugEndpointConf `envPrefix:"HEALTH_"`
+	PprofConf      debugEndpointConf `envPrefix:"PPROF_"`
+	PrometheusConf debugEndpointConf `envPrefix:"PROMETHEUS_"`
+	DNSDBConf      debugEndpointConf `envPrefix:"DNSDB_"`
+
 	LogTimestamp strictBool `env:"LOG_TIMESTAMP" envDefault:"1"`
 	LogVerbose   strictBool `env:"VERBOSE" envDefault:"0"`
+
+	DNSDBRefreshIvl           time.Duration `env:"DNSDB_REFRESH_INTERVAL" envDefault:"15m"`
+	DNSDBRefreshOnShutdown    strictBool    `env:"DNSDB_REFRESH_ON_SHUTDOWN" envDefault:"1"`
+	DNSDBRefreshJitter        time.Duration `env:"DNSDB_REFRESH_JITTER" envDefault:"0"`
+	RuleStatRefreshIvl        time.Duration `env:"RULESTAT_REFRESH_INTERVAL" envDefault:"10m"`
+	RuleStatRefreshOnShutdown strictBool    `env:"RULESTAT_REFRESH_ON_SHUTDOWN" envDefault:"1"`
+	RuleStatRefreshJitter     time.Duration `env:"RULESTAT_REFRESH_JITTER" envDefault:"0"`
+	GeoIPRefreshIvl           time.Duration `env:"GEOIP_REFRESH_INTERVAL" envDefault:"1m"`
+	GeoIPRefreshJitter        time.Duration `env:"GEOIP_REFRESH_JITTER" envDefault:"0"`
 }
 
 // readEnvs reads the configuration.
@@ -76,19 +95,16 @@ func (envs *environments) configureLogs() {
 	}
 }
 
-// buildErrColl builds and returns an error collector from environment.
+// buildErrColl builds and returns an error collector from environment.  The
+// SENTRY_DSN variable, despite its name, accepts the DSN schemes supported
+// by [errCollFromDSN], not just Sentry DSNs.
 func (envs *environments) buildErrColl() (errColl agd.ErrorCollector, err error) {
-	dsn := envs.SentryDSN
-	if dsn == "stderr" {
-		return errcoll.NewWriterErrorCollector(os.Stderr), nil
-	}
-
-	rc, err := raven.New(dsn)
+	errColl, err = errCollFromDSN(envs.SentryDSN)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error collector: %w", err)
 	}
 
-	return errcoll.NewRavenErrorCollector(rc), nil
+	return errColl, nil
 }
 
 // buildDNSDB builds and returns an anonymous statistics collector and its
@@ -106,24 +122,37 @@ func (envs *environments) buildDNSDB(
 	})
 
 	refr = agd.NewRefreshWorker(&agd.RefreshWorkerConfig{
-		Context:   ctxWithDefaultTimeout,
-		Refresher: b,
-		ErrColl:   errColl,
-		Name:      "dnsdb",
-		// TODO(ameshkov): Consider making configurable.
-		Interval:            15 * time.Minute,
-		RefreshOnShutdown:   true,
+		Context:             ctxWithDefaultTimeout,
+		Refresher:           b,
+		ErrColl:             errColl,
+		Name:                "dnsdb",
+		Interval:            jitterDuration(envs.DNSDBRefreshIvl, envs.DNSDBRefreshJitter),
+		RefreshOnShutdown:   bool(envs.DNSDBRefreshOnShutdown),
 		RoutineLogsAreDebug: false,
 	})
 
 	return b, refr
 }
 
-// geoIP returns an GeoIP database implementation from environment.
+// jitterDuration returns ivl plus a pseudorandom value in [0, jitter), to
+// avoid refresh herds when many instances share a backend.  It returns ivl
+// unchanged if jitter is non-positive.
+func jitterDuration(ivl, jitter time.Duration) (d time.Duration) {
+	if jitter <= 0 {
+		return ivl
+	}
+
+	return ivl + time.Duration(rand.Int63n(int64(jitter)))
+}
+
+// geoIP returns a GeoIP database implementation from environment, along with
+// the refresh-worker service that periodically re-stats the database files
+// as a fallback for file systems that don't reliably emit fsnotify events;
+// see [geoip.File].
 func (envs *environments) geoIP(
 	c *geoIPConfig,
 	errColl agd.ErrorCollector,
-) (g *geoip.File, err error) {
+) (g *geoip.File, refr agd.Service, err error) {
 	log.Debug("using geoip files %q and %q", envs.GeoIPASNPath, envs.GeoIPCountryPath)
 
 	g, err = geoip.NewFile(&geoip.FileConfig{
@@ -134,40 +163,176 @@ func (envs *environments) geoIP(
 		IPCacheSize:   c.IPCacheSize,
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return g, nil
+	refr = agd.NewRefreshWorker(&agd.RefreshWorkerConfig{
+		Context:             ctxWithDefaultTimeout,
+		Refresher:           g,
+		ErrColl:             errColl,
+		Name:                "geoip",
+		Interval:            jitterDuration(envs.GeoIPRefreshIvl, envs.GeoIPRefreshJitter),
+		RefreshOnShutdown:   false,
+		RoutineLogsAreDebug: true,
+	})
+
+	return g, refr, nil
 }
 
-// debugConf returns a debug HTTP service configuration from environment.
-func (envs *environments) debugConf(dnsDB dnsdb.Interface) (conf *debugsvc.Config) {
-	// TODO(a.garipov): Simplify the config if these are guaranteed to always be
-	// the same.
-	addr := netutil.JoinHostPort(envs.ListenAddr.String(), envs.ListenPort)
+// debugEndpointConf is the per-endpoint environment configuration for an
+// endpoint served by the debug HTTP service.  ListenAddr and ListenPort, if
+// unset, fall back to the top-level environments.ListenAddr and
+// environments.ListenPort.
+type debugEndpointConf struct {
+	// ListenAddr is the address to listen on, overriding the top-level
+	// LISTEN_ADDR if set.
+	ListenAddr net.IP `env:"LISTEN_ADDR"`
+
+	// ListenPort is the port to listen on, overriding the top-level
+	// LISTEN_PORT if set to a non-zero value.
+	ListenPort int `env:"LISTEN_PORT"`
+
+	// CertPath and KeyPath, if both set, make the endpoint serve TLS using
+	// that certificate and key.
+	CertPath string `env:"CERT_PATH"`
+	KeyPath  string `env:"KEY_PATH"`
+
+	// ClientCAPath, if set, makes the endpoint require and verify a client
+	// certificate signed by the CA in that file, turning the endpoint into
+	// an mTLS-only one.  It is only used if CertPath and KeyPath are also
+	// set.
+	ClientCAPath string `env:"CLIENT_CA_PATH"`
+
+	// Username and Password, if either is set, require HTTP Basic Auth with
+	// exactly these credentials.
+	Username string `env:"USERNAME"`
+	Password string `env:"PASSWORD"`
+
+	// BearerToken, if set, requires an "Authorization: Bearer <token>"
+	// header.
+	BearerToken string `env:"BEARER_TOKEN"`
+}
+
+// addr returns the effective bind address for ec, falling back to envs'
+// top-level ListenAddr and ListenPort.
+func (envs *environments) addr(ec *debugEndpointConf) (addr string) {
+	host := envs.ListenAddr.String()
+	if len(ec.ListenAddr) > 0 {
+		host = ec.ListenAddr.String()
+	}
+
+	port := envs.ListenPort
+	if ec.ListenPort != 0 {
+		port = ec.ListenPort
+	}
+
+	return netutil.JoinHostPort(host, port)
+}
+
+// tlsConf returns the TLS configuration described by ec, or nil if ec
+// doesn't configure TLS.
+func (ec *debugEndpointConf) tlsConf() (c *tls.Config, err error) {
+	if ec.CertPath == "" || ec.KeyPath == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(ec.CertPath, ec.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading certificate: %w", err)
+	}
+
+	c = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if ec.ClientCAPath == "" {
+		return c, nil
+	}
 
+	caPEM, err := os.ReadFile(ec.ClientCAPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("client CA %q: no certificates found", ec.ClientCAPath)
+	}
+
+	c.ClientCAs = pool
+	c.ClientAuth = tls.RequireAndVerifyClientCert
+
+	return c, nil
+}
+
+// authConf returns the access guard described by ec, or nil if ec doesn't
+// configure one.
+func (ec *debugEndpointConf) authConf() (a *debugsvc.AuthConfig) {
+	if ec.Username == "" && ec.Password == "" && ec.BearerToken == "" {
+		return nil
+	}
+
+	return &debugsvc.AuthConfig{
+		Username:    ec.Username,
+		Password:    ec.Password,
+		BearerToken: ec.BearerToken,
+	}
+}
+
+// debugConf returns a debug HTTP service configuration from environment.
+func (envs *environments) debugConf(dnsDB dnsdb.Interface) (conf *debugsvc.Config, err error) {
 	// TODO(a.garipov): Consider other ways of making the DNSDB API fully
 	// optional.
 	var dnsDBAddr string
 	var dnsDBHdlr http.Handler
 	if h, ok := dnsDB.(http.Handler); ok {
-		dnsDBAddr = addr
+		dnsDBAddr = envs.addr(&envs.DNSDBConf)
 		dnsDBHdlr = h
 	} else {
 		dnsDBAddr = ""
 		dnsDBHdlr = http.HandlerFunc(http.NotFound)
 	}
 
+	dnsDBTLS, err := envs.DNSDBConf.tlsConf()
+	if err != nil {
+		return nil, fmt.Errorf("dnsdb: %w", err)
+	}
+
+	healthTLS, err := envs.HealthConf.tlsConf()
+	if err != nil {
+		return nil, fmt.Errorf("health: %w", err)
+	}
+
+	pprofTLS, err := envs.PprofConf.tlsConf()
+	if err != nil {
+		return nil, fmt.Errorf("pprof: %w", err)
+	}
+
+	promTLS, err := envs.PrometheusConf.tlsConf()
+	if err != nil {
+		return nil, fmt.Errorf("prometheus: %w", err)
+	}
+
 	conf = &debugsvc.Config{
 		DNSDBAddr:    dnsDBAddr,
 		DNSDBHandler: dnsDBHdlr,
+		DNSDBTLS:     dnsDBTLS,
+		DNSDBAuth:    envs.DNSDBConf.authConf(),
+
+		HealthAddr: envs.addr(&envs.HealthConf),
+		HealthTLS:  healthTLS,
+		HealthAuth: envs.HealthConf.authConf(),
+
+		PprofAddr: envs.addr(&envs.PprofConf),
+		PprofTLS:  pprofTLS,
+		PprofAuth: envs.PprofConf.authConf(),
 
-		HealthAddr:     addr,
-		PprofAddr:      addr,
-		PrometheusAddr: addr,
+		PrometheusAddr: envs.addr(&envs.PrometheusConf),
+		PrometheusTLS:  promTLS,
+		PrometheusAuth: envs.PrometheusConf.authConf(),
 	}
 
-	return conf
+	return conf, nil
 }
 
 // ruleStat returns a filtering rule statistics collector from environment.  It
@@ -186,13 +351,12 @@ func (envs *environments) ruleStat(
 	})
 
 	refr = agd.NewRefreshWorker(&agd.RefreshWorkerConfig{
-		Context:   ctxWithDefaultTimeout,
-		Refresher: httpRuleStat,
-		ErrColl:   errColl,
-		Name:      "rulestat",
-		// TODO(ameshkov): Consider making configurable.
-		Interval:            10 * time.Minute,
-		RefreshOnShutdown:   true,
+		Context:             ctxWithDefaultTimeout,
+		Refresher:           httpRuleStat,
+		ErrColl:             errColl,
+		Name:                "rulestat",
+		Interval:            jitterDuration(envs.RuleStatRefreshIvl, envs.RuleStatRefreshJitter),
+		RefreshOnShutdown:   bool(envs.RuleStatRefreshOnShutdown),
 		RoutineLogsAreDebug: false,
 	})
 
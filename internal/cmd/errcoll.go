@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"fmt"
+	"log/syslog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/agd"
+	"github.com/AdguardTeam/AdGuardDNS/internal/errcoll"
+	"github.com/getsentry/raven-go"
+)
+
+// otlpTimeout is the per-request timeout used for the OTLP error collector.
+const otlpTimeout = 10 * time.Second
+
+// Error Collector Configuration
+
+// errCollFromDSN builds an error collector from a DSN string.  The following
+// schemes are supported:
+//
+//   - "stderr": the default, writes errors to stderr.
+//   - "otlp+http://": export errors as OTLP log records over OTLP/HTTP.
+//     "otlp+grpc://" is rejected with an error; there is no gRPC exporter.
+//   - "syslog://": report errors to a syslog daemon.  The part of the DSN
+//     after the scheme is either empty, for the local syslog daemon, or
+//     "host:port?facility=…&proto=udp|tcp|unix", where facility is one of
+//     the standard syslog facility names (e.g. "daemon", "local0") and proto
+//     defaults to "udp" if unset.
+//   - "file://": append errors to a local file, rotating it once it grows
+//     too large.  The part of the DSN after the scheme is the file path,
+//     optionally followed by "?maxsize=…&maxbackups=…", where maxsize is the
+//     rotation threshold in bytes (default 100MiB) and maxbackups is the
+//     number of rotated files to keep (default 5).
+//   - "multi://": a comma-separated list of the DSNs above, reporting every
+//     error to each of them.
+//   - anything else is assumed to be a Sentry DSN.
+func errCollFromDSN(dsn string) (errColl agd.ErrorCollector, err error) {
+	if dsn == "stderr" {
+		return errcoll.NewWriterErrorCollector(os.Stderr), nil
+	}
+
+	scheme, rest, hasScheme := strings.Cut(dsn, "://")
+	if !hasScheme {
+		return buildSentryErrColl(dsn)
+	}
+
+	switch scheme {
+	case "otlp+grpc", "otlp+http":
+		return buildOTLPErrColl(scheme, rest)
+	case "syslog":
+		return buildSyslogErrColl(rest)
+	case "file":
+		return buildFileErrColl(rest)
+	case "multi":
+		return buildMultiErrColl(rest)
+	default:
+		return buildSentryErrColl(dsn)
+	}
+}
+
+// buildSentryErrColl builds a Sentry-backed error collector from dsn.
+func buildSentryErrColl(dsn string) (errColl agd.ErrorCollector, err error) {
+	rc, err := raven.New(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sentry dsn: %w", err)
+	}
+
+	return errcoll.NewRavenErrorCollector(rc), nil
+}
+
+// buildOTLPErrColl builds an OTLP-backed error collector.  scheme is either
+// "otlp+grpc" or "otlp+http"; endpoint is the part of the DSN after "://".
+// "otlp+grpc" is rejected, since this tree doesn't vendor a gRPC OTLP
+// exporter; use "otlp+http" instead.
+func buildOTLPErrColl(scheme, endpoint string) (errColl agd.ErrorCollector, err error) {
+	if scheme == "otlp+grpc" {
+		return nil, fmt.Errorf("otlp dsn: %q transport is not yet supported, use otlp+http", scheme)
+	}
+
+	return errcoll.NewOTLP(&errcoll.OTLPConfig{
+		Endpoint:  "http://" + endpoint,
+		Transport: errcoll.OTLPTransportHTTP,
+		Timeout:   otlpTimeout,
+	})
+}
+
+// syslogFacilities maps the facility names accepted in a syslog DSN's
+// "facility" query parameter to the corresponding [syslog.Priority].
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// buildSyslogErrColl builds a syslog-backed error collector.  target is the
+// part of the DSN after "syslog://"; an empty target means the local syslog
+// daemon, while a non-empty one is "host:port", optionally followed by
+// "?facility=…&proto=udp|tcp|unix".
+func buildSyslogErrColl(target string) (errColl agd.ErrorCollector, err error) {
+	c := &errcoll.SyslogConfig{
+		Tag: "AdGuardDNS",
+	}
+
+	if target == "" {
+		return errcoll.NewSyslog(c)
+	}
+
+	addr, rawQuery, _ := strings.Cut(target, "?")
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("syslog dsn: bad query: %w", err)
+	}
+
+	c.Network = "udp"
+	if proto := q.Get("proto"); proto != "" {
+		c.Network = proto
+	}
+
+	c.Addr = addr
+
+	if facility := q.Get("facility"); facility != "" {
+		f, ok := syslogFacilities[facility]
+		if !ok {
+			return nil, fmt.Errorf("syslog dsn: unknown facility %q", facility)
+		}
+
+		c.Facility = f
+	}
+
+	return errcoll.NewSyslog(c)
+}
+
+// buildFileErrColl builds a file-backed error collector.  target is the part
+// of the DSN after "file://": the file path, optionally followed by
+// "?maxsize=…&maxbackups=…".
+func buildFileErrColl(target string) (errColl agd.ErrorCollector, err error) {
+	path, rawQuery, _ := strings.Cut(target, "?")
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("file dsn: bad query: %w", err)
+	}
+
+	c := &errcoll.FileConfig{
+		Path:         path,
+		MaxSizeBytes: 100 * 1024 * 1024,
+		MaxBackups:   5,
+	}
+
+	if v := q.Get("maxsize"); v != "" {
+		c.MaxSizeBytes, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("file dsn: bad maxsize: %w", err)
+		}
+	}
+
+	if v := q.Get("maxbackups"); v != "" {
+		c.MaxBackups, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("file dsn: bad maxbackups: %w", err)
+		}
+	}
+
+	return errcoll.NewFile(c)
+}
+
+// buildMultiErrColl builds a composite error collector from a comma-separated
+// list of DSNs.
+func buildMultiErrColl(dsnList string) (errColl agd.ErrorCollector, err error) {
+	dsns := strings.Split(dsnList, ",")
+	colls := make([]agd.ErrorCollector, len(dsns))
+	for i, dsn := range dsns {
+		colls[i], err = errCollFromDSN(strings.TrimSpace(dsn))
+		if err != nil {
+			return nil, fmt.Errorf("multi dsn at index %d: %w", i, err)
+		}
+	}
+
+	return errcoll.NewMulti(colls...), nil
+}
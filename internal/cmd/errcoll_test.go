@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBuildOTLPErrColl_grpcRejected makes sure that an "otlp+grpc://" DSN is
+// rejected explicitly instead of silently falling back to the OTLP/HTTP JSON
+// transport, since this tree doesn't vendor a gRPC OTLP exporter.
+func TestBuildOTLPErrColl_grpcRejected(t *testing.T) {
+	_, err := buildOTLPErrColl("otlp+grpc", "otel.example.com:4317")
+	assert.Error(t, err)
+}
+
+// TestBuildOTLPErrColl_http makes sure that an "otlp+http://" DSN still
+// builds successfully.
+func TestBuildOTLPErrColl_http(t *testing.T) {
+	_, err := buildOTLPErrColl("otlp+http", "otel.example.com:4318")
+	assert.NoError(t, err)
+}
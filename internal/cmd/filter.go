@@ -31,6 +31,28 @@ type filtersConfig struct {
 	// Note that each individual refresh operation also has its own hardcoded
 	// 30s timeout.
 	RefreshTimeout timeutil.Duration `yaml:"refresh_timeout"`
+
+	// RefreshJitter is the maximum amount of time that the initial refresh of
+	// each filter list in the index is randomly delayed by, so that a large
+	// index doesn't stampede the origin on startup.
+	RefreshJitter timeutil.Duration `yaml:"refresh_jitter"`
+
+	// HostsFiles are the hosts-format sources that are synthesized directly
+	// into A/AAAA/PTR answers.
+	HostsFiles []hostsFileConfig `yaml:"hosts_files"`
+}
+
+// hostsFileConfig is the YAML configuration of a single hosts-format source.
+type hostsFileConfig struct {
+	// Source is either a local file path or an "http://"/"https://" URL.
+	Source string `yaml:"source"`
+
+	// RefreshIvl is the interval between refreshes of this source.
+	RefreshIvl timeutil.Duration `yaml:"refresh_interval"`
+
+	// Priority determines which source wins when the same name or address is
+	// defined in more than one hosts file; higher values win.
+	Priority int `yaml:"priority"`
 }
 
 // toInternal converts c to the filter storage configuration for the DNS server.
@@ -39,6 +61,15 @@ func (c *filtersConfig) toInternal(
 	errColl agd.ErrorCollector,
 	envs *environments,
 ) (conf *filter.DefaultStorageConfig) {
+	hostsFiles := make([]filter.HostsFileConfig, len(c.HostsFiles))
+	for i, hf := range c.HostsFiles {
+		hostsFiles[i] = filter.HostsFileConfig{
+			Source:     hf.Source,
+			RefreshIvl: hf.RefreshIvl.Duration,
+			Priority:   hf.Priority,
+		}
+	}
+
 	return &filter.DefaultStorageConfig{
 		FilterIndexURL:            netutil.CloneURL(&envs.FilterIndexURL.URL),
 		BlockedServiceIndexURL:    netutil.CloneURL(&envs.BlockedServiceIndexURL.URL),
@@ -52,6 +83,8 @@ func (c *filtersConfig) toInternal(
 		// TODO(a.garipov): Consider making this configurable.
 		SafeSearchCacheTTL: 1 * time.Hour,
 		RefreshIvl:         c.RefreshIvl.Duration,
+		RefreshJitter:      c.RefreshJitter.Duration,
+		HostsFiles:         hostsFiles,
 	}
 }
 
@@ -66,6 +99,8 @@ func (c *filtersConfig) validate() (err error) {
 		return newMustBePositiveError("refresh_interval", c.RefreshIvl)
 	case c.RefreshTimeout.Duration <= 0:
 		return newMustBePositiveError("refresh_timeout", c.RefreshTimeout)
+	case c.RefreshJitter.Duration < 0:
+		return newMustBePositiveError("refresh_jitter", c.RefreshJitter)
 	default:
 		return nil
 	}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/geoip"
+	"github.com/AdguardTeam/AdGuardDNS/internal/websvc"
+)
+
+// Linked IP Upstream Configuration
+
+// linkedIPUpstreamConfig is the YAML configuration for the transport used to
+// reach a linked-IP backend.
+type linkedIPUpstreamConfig struct {
+	// Bootstrap are the addresses of the DNS servers used to resolve the
+	// backend's hostname.  Each one may be a plain "host:port" or an
+	// encrypted DNS URL, e.g. "tls://dns.example.com".
+	Bootstrap []string `yaml:"bootstrap"`
+
+	// SNI, if set, overrides the TLS server name sent to the backend.
+	SNI string `yaml:"sni"`
+
+	// EnableHTTP3 marks the backend as reached over HTTP/3.  The "h3://"
+	// backend URL scheme selects HTTP/3 on its own; setting EnableHTTP3 with
+	// any other scheme is an error.
+	EnableHTTP3 bool `yaml:"enable_http3"`
+}
+
+// toInternal converts c to the linked IP upstream configuration used by the
+// websvc package.  c may be nil.
+func (c *linkedIPUpstreamConfig) toInternal() (conf *websvc.LinkedIPUpstreamConfig) {
+	if c == nil {
+		return nil
+	}
+
+	return &websvc.LinkedIPUpstreamConfig{
+		Bootstrap:   c.Bootstrap,
+		SNI:         c.SNI,
+		EnableHTTP3: c.EnableHTTP3,
+	}
+}
+
+// Linked IP Access Control Configuration
+
+// linkedIPAccessConfig is the YAML configuration for the access-control
+// layer in front of the linked-IP and DDNS endpoints.
+type linkedIPAccessConfig struct {
+	// AllowedNets are the CIDR prefixes allowed to reach the endpoints.
+	AllowedNets []string `yaml:"allowed_nets"`
+
+	// BlockedNets are the CIDR prefixes denied access to the endpoints.
+	BlockedNets []string `yaml:"blocked_nets"`
+
+	// BlockedASN are the autonomous system numbers denied access.
+	BlockedASN []uint32 `yaml:"blocked_asn"`
+
+	// RateLimitRPS is the steady-state number of requests per second allowed
+	// per source IP address.
+	RateLimitRPS float64 `yaml:"rate_limit_rps"`
+
+	// RateLimitBurst is the maximum burst size allowed per source IP
+	// address.
+	RateLimitBurst int `yaml:"rate_limit_burst"`
+}
+
+// toInternal converts c to the access-control configuration used by the
+// websvc package.  c may be nil, in which case access control is disabled.
+func (c *linkedIPAccessConfig) toInternal(asn *geoip.File) (conf *websvc.AccessConfig, err error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	allowed, err := parsePrefixes(c.AllowedNets)
+	if err != nil {
+		return nil, fmt.Errorf("allowed_nets: %w", err)
+	}
+
+	blocked, err := parsePrefixes(c.BlockedNets)
+	if err != nil {
+		return nil, fmt.Errorf("blocked_nets: %w", err)
+	}
+
+	return &websvc.AccessConfig{
+		ASN:            asn,
+		Allowed:        allowed,
+		Blocked:        blocked,
+		BlockedASN:     c.BlockedASN,
+		RateLimitRPS:   c.RateLimitRPS,
+		RateLimitBurst: c.RateLimitBurst,
+	}, nil
+}
+
+// parsePrefixes parses a list of CIDR strings into [netip.Prefix] values.
+func parsePrefixes(strs []string) (prefixes []netip.Prefix, err error) {
+	prefixes = make([]netip.Prefix, len(strs))
+	for i, s := range strs {
+		prefixes[i], err = netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("prefix at index %d: %w", i, err)
+		}
+	}
+
+	return prefixes, nil
+}
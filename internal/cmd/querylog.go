@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/agd"
+	"github.com/AdguardTeam/AdGuardDNS/internal/querylog"
+	"github.com/AdguardTeam/golibs/timeutil"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// Query Log Sinks Configuration
+
+// queryLogSinksConfig is the configuration for the additional query log
+// sinks, on top of the mandatory file-system one.
+type queryLogSinksConfig struct {
+	// Loki is the configuration for the Loki sink.  It is disabled if nil.
+	Loki *queryLogLokiConfig `yaml:"loki"`
+
+	// Elastic is the configuration for the Elasticsearch/OpenSearch sink.  It
+	// is disabled if nil.
+	Elastic *queryLogElasticConfig `yaml:"elastic"`
+
+	// Kafka is the configuration for the Kafka sink.  It is disabled if nil.
+	Kafka *queryLogKafkaConfig `yaml:"kafka"`
+
+	// AsyncQueueSize is the size of the bounded queue used to buffer entries
+	// for the sinks above before they are dropped.
+	AsyncQueueSize int `yaml:"async_queue_size"`
+}
+
+// queryLogLokiConfig is the YAML configuration for the Loki sink.
+type queryLogLokiConfig struct {
+	URL        string            `yaml:"url"`
+	TenantID   string            `yaml:"tenant_id"`
+	BatchSize  int               `yaml:"batch_size"`
+	FlushIvl   timeutil.Duration `yaml:"flush_interval"`
+	MaxRetries int               `yaml:"max_retries"`
+}
+
+// queryLogElasticConfig is the YAML configuration for the Elasticsearch
+// sink.
+type queryLogElasticConfig struct {
+	URL         string            `yaml:"url"`
+	IndexPrefix string            `yaml:"index_prefix"`
+	BatchSize   int               `yaml:"batch_size"`
+	FlushIvl    timeutil.Duration `yaml:"flush_interval"`
+}
+
+// queryLogKafkaConfig is the YAML configuration for the Kafka sink.
+type queryLogKafkaConfig struct {
+	Brokers      []string `yaml:"brokers"`
+	Topic        string   `yaml:"topic"`
+	RequiredAcks string   `yaml:"required_acks"`
+	Compression  string   `yaml:"compression"`
+}
+
+// toInternal returns the additional query log sinks described by c, along
+// with the mandatory file-system sink fsSink.  If any additional sink is
+// configured, all sinks are wrapped in a [querylog.BufferedAsync] so that a
+// slow or unreachable backend doesn't block request handling; otherwise
+// fsSink is returned unwrapped.
+func (c *queryLogSinksConfig) toInternal(
+	fsSink querylog.Interface,
+	errColl agd.ErrorCollector,
+) (i querylog.Interface, err error) {
+	sinks := []querylog.Interface{fsSink}
+
+	if c.Loki != nil {
+		sinks = append(sinks, querylog.NewLoki(&querylog.LokiConfig{
+			URL:        c.Loki.URL,
+			TenantID:   c.Loki.TenantID,
+			BatchSize:  c.Loki.BatchSize,
+			FlushIvl:   c.Loki.FlushIvl.Duration,
+			MaxRetries: c.Loki.MaxRetries,
+		}))
+	}
+
+	if c.Elastic != nil {
+		sinks = append(sinks, querylog.NewElastic(&querylog.ElasticConfig{
+			URL:         c.Elastic.URL,
+			IndexPrefix: c.Elastic.IndexPrefix,
+			BatchSize:   c.Elastic.BatchSize,
+			FlushIvl:    c.Elastic.FlushIvl.Duration,
+		}))
+	}
+
+	if c.Kafka != nil {
+		acks, kErr := parseKafkaRequiredAcks(c.Kafka.RequiredAcks)
+		if kErr != nil {
+			return nil, fmt.Errorf("querylog.sinks.kafka.required_acks: %w", kErr)
+		}
+
+		sinks = append(sinks, querylog.NewKafka(&querylog.KafkaConfig{
+			Brokers:      c.Kafka.Brokers,
+			Topic:        c.Kafka.Topic,
+			RequiredAcks: acks,
+			Compression:  parseKafkaCompression(c.Kafka.Compression),
+		}))
+	}
+
+	if len(sinks) == 1 {
+		return fsSink, nil
+	}
+
+	async := querylog.NewBufferedAsync(&querylog.BufferedAsyncConfig{
+		Sink:      querylog.NewMultiSink(sinks...),
+		ErrColl:   errColl,
+		QueueSize: c.AsyncQueueSize,
+	})
+
+	return async, nil
+}
+
+// parseKafkaRequiredAcks converts a YAML value into the corresponding
+// [kafka.RequiredAcks] value.
+func parseKafkaRequiredAcks(s string) (acks kafka.RequiredAcks, err error) {
+	switch s {
+	case "", "all":
+		return kafka.RequireAll, nil
+	case "one":
+		return kafka.RequireOne, nil
+	case "none":
+		return kafka.RequireNone, nil
+	default:
+		return 0, fmt.Errorf("unknown value %q, supported: %q, %q, %q", s, "all", "one", "none")
+	}
+}
+
+// parseKafkaCompression converts a YAML value into the corresponding
+// [kafka.Compression] value, defaulting to no compression.
+func parseKafkaCompression(s string) (c kafka.Compression) {
+	switch s {
+	case "gzip":
+		return kafka.Gzip
+	case "snappy":
+		return kafka.Snappy
+	case "lz4":
+		return kafka.Lz4
+	case "zstd":
+		return kafka.Zstd
+	default:
+		return 0
+	}
+}
+
+// validate returns an error if the query log sinks configuration is invalid.
+func (c *queryLogSinksConfig) validate() (err error) {
+	if c == nil {
+		return errNilConfig
+	}
+
+	if c.AsyncQueueSize <= 0 {
+		return newMustBePositiveError("async_queue_size", c.AsyncQueueSize)
+	}
+
+	if err = c.Loki.validate(); err != nil {
+		return fmt.Errorf("loki: %w", err)
+	}
+
+	if err = c.Elastic.validate(); err != nil {
+		return fmt.Errorf("elastic: %w", err)
+	}
+
+	return nil
+}
+
+// validate returns an error if the Loki sink configuration is invalid.  c may
+// be nil, in which case the Loki sink is disabled and there is nothing to
+// validate.
+func (c *queryLogLokiConfig) validate() (err error) {
+	if c == nil {
+		return nil
+	}
+
+	switch {
+	case c.URL == "":
+		return newMustNotBeEmptyError("url")
+	case c.BatchSize <= 0:
+		return newMustBePositiveError("batch_size", c.BatchSize)
+	case c.FlushIvl.Duration <= 0:
+		return newMustBePositiveError("flush_interval", c.FlushIvl)
+	default:
+		return nil
+	}
+}
+
+// validate returns an error if the Elasticsearch sink configuration is
+// invalid.  c may be nil, in which case the Elastic sink is disabled and
+// there is nothing to validate.
+func (c *queryLogElasticConfig) validate() (err error) {
+	if c == nil {
+		return nil
+	}
+
+	switch {
+	case c.URL == "":
+		return newMustNotBeEmptyError("url")
+	case c.BatchSize <= 0:
+		return newMustBePositiveError("batch_size", c.BatchSize)
+	case c.FlushIvl.Duration <= 0:
+		return newMustBePositiveError("flush_interval", c.FlushIvl)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/golibs/timeutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestQueryLogSinksConfig_validate makes sure that a zero-valued Loki or
+// Elastic sub-configuration — in particular a zero FlushIvl, which would
+// otherwise panic inside [time.NewTicker] — is rejected by validate instead
+// of reaching [querylog.NewLoki]/[querylog.NewElastic].
+func TestQueryLogSinksConfig_validate(t *testing.T) {
+	validLoki := &queryLogLokiConfig{
+		URL:       "http://loki.example.com/loki/api/v1/push",
+		BatchSize: 100,
+		FlushIvl:  timeutil.Duration{Duration: 1 * time.Second},
+	}
+
+	validElastic := &queryLogElasticConfig{
+		URL:       "http://elastic.example.com",
+		BatchSize: 100,
+		FlushIvl:  timeutil.Duration{Duration: 1 * time.Second},
+	}
+
+	testCases := []struct {
+		name string
+		c    *queryLogSinksConfig
+		ok   bool
+	}{{
+		name: "nil",
+		c:    nil,
+		ok:   false,
+	}, {
+		name: "no_additional_sinks",
+		c:    &queryLogSinksConfig{AsyncQueueSize: 100},
+		ok:   true,
+	}, {
+		name: "valid_loki_and_elastic",
+		c: &queryLogSinksConfig{
+			AsyncQueueSize: 100,
+			Loki:           validLoki,
+			Elastic:        validElastic,
+		},
+		ok: true,
+	}, {
+		name: "bad_async_queue_size",
+		c:    &queryLogSinksConfig{AsyncQueueSize: 0},
+		ok:   false,
+	}, {
+		name: "loki_empty_url",
+		c: &queryLogSinksConfig{
+			AsyncQueueSize: 100,
+			Loki: &queryLogLokiConfig{
+				BatchSize: 100,
+				FlushIvl:  timeutil.Duration{Duration: 1 * time.Second},
+			},
+		},
+		ok: false,
+	}, {
+		name: "loki_bad_batch_size",
+		c: &queryLogSinksConfig{
+			AsyncQueueSize: 100,
+			Loki: &queryLogLokiConfig{
+				URL:      "http://loki.example.com",
+				FlushIvl: timeutil.Duration{Duration: 1 * time.Second},
+			},
+		},
+		ok: false,
+	}, {
+		name: "loki_zero_flush_interval",
+		c: &queryLogSinksConfig{
+			AsyncQueueSize: 100,
+			Loki: &queryLogLokiConfig{
+				URL:       "http://loki.example.com",
+				BatchSize: 100,
+			},
+		},
+		ok: false,
+	}, {
+		name: "elastic_empty_url",
+		c: &queryLogSinksConfig{
+			AsyncQueueSize: 100,
+			Elastic: &queryLogElasticConfig{
+				BatchSize: 100,
+				FlushIvl:  timeutil.Duration{Duration: 1 * time.Second},
+			},
+		},
+		ok: false,
+	}, {
+		name: "elastic_zero_flush_interval",
+		c: &queryLogSinksConfig{
+			AsyncQueueSize: 100,
+			Elastic: &queryLogElasticConfig{
+				URL:       "http://elastic.example.com",
+				BatchSize: 100,
+			},
+		},
+		ok: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.c.validate()
+			if tc.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+// Package debugsvc contains the debug HTTP service: health checks, pprof,
+// Prometheus metrics, and (optionally) the DNSDB API.
+package debugsvc
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"sync"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/agd"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// AuthConfig is the access guard for a single debug endpoint.  Exactly one
+// of Username/Password or BearerToken should be set; if neither is, the
+// endpoint is left unguarded.
+type AuthConfig struct {
+	// Username and Password, if either is set, require HTTP Basic Auth with
+	// exactly these credentials.
+	Username string
+	Password string
+
+	// BearerToken, if set, requires an "Authorization: Bearer <token>"
+	// header.
+	BearerToken string
+}
+
+// middleware wraps h with the configured guard.  a may be nil, in which
+// case h is returned unchanged.
+func (a *AuthConfig) middleware(h http.Handler) (wrapped http.Handler) {
+	if a == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.allow(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="debugsvc"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// allow returns true if r satisfies a's guard.
+func (a *AuthConfig) allow(r *http.Request) (ok bool) {
+	if a.BearerToken != "" {
+		const prefix = "Bearer "
+		hdr := r.Header.Get("Authorization")
+
+		return len(hdr) > len(prefix) &&
+			strings.HasPrefix(hdr, prefix) &&
+			subtle.ConstantTimeCompare([]byte(hdr[len(prefix):]), []byte(a.BearerToken)) == 1
+	}
+
+	if a.Username != "" || a.Password != "" {
+		u, p, hasAuth := r.BasicAuth()
+
+		return hasAuth &&
+			subtle.ConstantTimeCompare([]byte(u), []byte(a.Username)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(p), []byte(a.Password)) == 1
+	}
+
+	return true
+}
+
+// Config is the configuration for the debug HTTP service.  Each endpoint
+// may be bound to its own address, use its own TLS configuration, and be
+// guarded by its own [AuthConfig].  Endpoints that share a bind address are
+// served from the same [*http.Server]; in that case, only the first
+// non-nil TLS configuration among them is used.
+type Config struct {
+	// DNSDBAddr is the address to serve the DNSDB API on.  If empty, the
+	// DNSDB API isn't served.
+	DNSDBAddr string
+
+	// DNSDBHandler serves the DNSDB API.  It is only used if DNSDBAddr is
+	// set.
+	DNSDBHandler http.Handler
+
+	// DNSDBTLS is the optional TLS configuration for the DNSDB endpoint.
+	DNSDBTLS *tls.Config
+
+	// DNSDBAuth is the optional access guard for the DNSDB endpoint.
+	DNSDBAuth *AuthConfig
+
+	// HealthAddr is the address to serve the health check on.
+	HealthAddr string
+
+	// HealthTLS is the optional TLS configuration for the health endpoint.
+	HealthTLS *tls.Config
+
+	// HealthAuth is the optional access guard for the health endpoint.
+	HealthAuth *AuthConfig
+
+	// PprofAddr is the address to serve net/http/pprof on.
+	PprofAddr string
+
+	// PprofTLS is the optional TLS configuration for the pprof endpoint.
+	PprofTLS *tls.Config
+
+	// PprofAuth is the optional access guard for the pprof endpoint.
+	PprofAuth *AuthConfig
+
+	// PrometheusAddr is the address to serve Prometheus metrics on.
+	PrometheusAddr string
+
+	// PrometheusTLS is the optional TLS configuration for the Prometheus
+	// endpoint.
+	PrometheusTLS *tls.Config
+
+	// PrometheusAuth is the optional access guard for the Prometheus
+	// endpoint.
+	PrometheusAuth *AuthConfig
+}
+
+// endpoint is a single named handler to mount, along with where and how.
+type endpoint struct {
+	path    string
+	handler http.Handler
+	addr    string
+	tlsConf *tls.Config
+	auth    *AuthConfig
+}
+
+// Service is the debug HTTP service.  It implements the [agd.Service]
+// interface.
+type Service struct {
+	servers []*http.Server
+}
+
+// New returns a new *Service using the given configuration.  c must not be
+// nil.
+func New(c *Config) (svc *Service) {
+	eps := []endpoint{{
+		path:    "/health",
+		handler: http.HandlerFunc(serveHealth),
+		addr:    c.HealthAddr,
+		tlsConf: c.HealthTLS,
+		auth:    c.HealthAuth,
+	}, {
+		path:    "/debug/pprof/",
+		handler: http.HandlerFunc(pprof.Index),
+		addr:    c.PprofAddr,
+		tlsConf: c.PprofTLS,
+		auth:    c.PprofAuth,
+	}, {
+		path:    "/metrics",
+		handler: promhttp.Handler(),
+		addr:    c.PrometheusAddr,
+		tlsConf: c.PrometheusTLS,
+		auth:    c.PrometheusAuth,
+	}}
+
+	if c.DNSDBAddr != "" && c.DNSDBHandler != nil {
+		eps = append(eps, endpoint{
+			path:    "/dnsdb",
+			handler: c.DNSDBHandler,
+			addr:    c.DNSDBAddr,
+			tlsConf: c.DNSDBTLS,
+			auth:    c.DNSDBAuth,
+		})
+	}
+
+	return &Service{
+		servers: buildServers(eps),
+	}
+}
+
+// buildServers groups eps by bind address and returns one [*http.Server]
+// per unique, non-empty address.
+func buildServers(eps []endpoint) (servers []*http.Server) {
+	muxes := map[string]*http.ServeMux{}
+	tlsConfs := map[string]*tls.Config{}
+	order := []string{}
+
+	for _, ep := range eps {
+		if ep.addr == "" {
+			continue
+		}
+
+		mux, ok := muxes[ep.addr]
+		if !ok {
+			mux = http.NewServeMux()
+			muxes[ep.addr] = mux
+			order = append(order, ep.addr)
+		}
+
+		mux.Handle(ep.path, ep.auth.middleware(ep.handler))
+
+		if ep.tlsConf != nil && tlsConfs[ep.addr] == nil {
+			tlsConfs[ep.addr] = ep.tlsConf
+		}
+	}
+
+	for _, addr := range order {
+		servers = append(servers, &http.Server{
+			Addr:      addr,
+			Handler:   muxes[addr],
+			TLSConfig: tlsConfs[addr],
+		})
+	}
+
+	return servers
+}
+
+// serveHealth is the handler for the health-check endpoint.
+func serveHealth(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("OK"))
+}
+
+// type check
+var _ agd.Service = (*Service)(nil)
+
+// Start implements the [agd.Service] interface for *Service.  It starts
+// every underlying HTTP(S) server in its own goroutine and returns
+// immediately; listener errors are logged.
+func (svc *Service) Start(_ context.Context) (err error) {
+	for _, srv := range svc.servers {
+		srv := srv
+		go func() {
+			var srvErr error
+			if srv.TLSConfig != nil {
+				srvErr = srv.ListenAndServeTLS("", "")
+			} else {
+				srvErr = srv.ListenAndServe()
+			}
+
+			if srvErr != nil && srvErr != http.ErrServerClosed {
+				log.Error("debugsvc: serving %s: %s", srv.Addr, srvErr)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// Shutdown implements the [agd.Service] interface for *Service.  It shuts
+// down every underlying server, collecting and joining any errors.
+func (svc *Service) Shutdown(ctx context.Context) (err error) {
+	var errs []error
+	for _, srv := range svc.servers {
+		if sErr := srv.Shutdown(ctx); sErr != nil {
+			errs = append(errs, fmt.Errorf("shutting down %s: %w", srv.Addr, sErr))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,275 @@
+package dnsmsg
+
+import (
+	"net"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// Cloner is a pooled deep-copy engine for *dns.Msg values.  It keeps a
+// [sync.Pool] per message, RR slice, and per-RR-type backing array so that
+// repeatedly cloning and disposing of messages, as AdGuardDNS does for every
+// response it filters or caches, reuses memory instead of allocating it
+// anew each time.
+//
+// The RR types most commonly seen in answers — A, AAAA, CNAME, OPT, SOA,
+// MX, TXT, and SVCB/HTTPS — are pool-backed.  Any other RR type falls back
+// to [dns.Copy], which still performs a correct deep copy, just without the
+// pooling benefit.
+//
+// A *Cloner must be created with [NewCloner]; the zero Cloner is not usable.
+type Cloner struct {
+	msgPool   *sync.Pool
+	rrPool    *sync.Pool
+	aPool     *sync.Pool
+	aaaaPool  *sync.Pool
+	cnamePool *sync.Pool
+	optPool   *sync.Pool
+	soaPool   *sync.Pool
+	mxPool    *sync.Pool
+	txtPool   *sync.Pool
+	svcbPool  *sync.Pool
+	httpsPool *sync.Pool
+}
+
+// NewCloner returns a new, ready-to-use *Cloner.
+func NewCloner() (c *Cloner) {
+	return &Cloner{
+		msgPool:   &sync.Pool{New: func() any { return &dns.Msg{} }},
+		rrPool:    &sync.Pool{New: func() any { return make([]dns.RR, 0, 8) }},
+		aPool:     &sync.Pool{New: func() any { return &dns.A{} }},
+		aaaaPool:  &sync.Pool{New: func() any { return &dns.AAAA{} }},
+		cnamePool: &sync.Pool{New: func() any { return &dns.CNAME{} }},
+		optPool:   &sync.Pool{New: func() any { return &dns.OPT{} }},
+		soaPool:   &sync.Pool{New: func() any { return &dns.SOA{} }},
+		mxPool:    &sync.Pool{New: func() any { return &dns.MX{} }},
+		txtPool:   &sync.Pool{New: func() any { return &dns.TXT{} }},
+		svcbPool:  &sync.Pool{New: func() any { return &dns.SVCB{} }},
+		httpsPool: &sync.Pool{New: func() any { return &dns.HTTPS{} }},
+	}
+}
+
+// Clone returns a deep copy of msg, obtaining its components from c's pools
+// where possible.  Clone preserves the nilness-of-section invariant
+// documented on the package-level [Clone] function.  Use [Cloner.Dispose] to
+// return the clone's components to c's pools once the caller is done with
+// it.  msg must not be nil.
+func (c *Cloner) Clone(msg *dns.Msg) (clone *dns.Msg) {
+	clone = c.msgPool.Get().(*dns.Msg)
+	*clone = *msg
+
+	clone.Question = cloneQuestions(msg.Question)
+	clone.Answer = c.cloneRRs(msg.Answer)
+	clone.Ns = c.cloneRRs(msg.Ns)
+	clone.Extra = c.cloneRRs(msg.Extra)
+
+	return clone
+}
+
+// Dispose returns msg's components to c's pools for reuse, resetting each of
+// them to its zero value.  msg must have been obtained from c.Clone; msg and
+// any of its components must not be used again afterwards.  Dispose does
+// nothing if msg is nil.
+func (c *Cloner) Dispose(msg *dns.Msg) {
+	if msg == nil {
+		return
+	}
+
+	c.disposeRRs(msg.Answer)
+	c.disposeRRs(msg.Ns)
+	c.disposeRRs(msg.Extra)
+
+	*msg = dns.Msg{}
+	c.msgPool.Put(msg)
+}
+
+// cloneQuestions returns a deep copy of qs, or nil if qs is nil.
+func cloneQuestions(qs []dns.Question) (clone []dns.Question) {
+	if qs == nil {
+		return nil
+	}
+
+	return append([]dns.Question(nil), qs...)
+}
+
+// cloneRRs returns a deep copy of rrs, obtaining the backing slice and,
+// where possible, each RR from c's pools.  It returns nil if rrs is nil.
+func (c *Cloner) cloneRRs(rrs []dns.RR) (clones []dns.RR) {
+	if rrs == nil {
+		return nil
+	}
+
+	clones = c.rrPool.Get().([]dns.RR)[:0]
+	for _, rr := range rrs {
+		clones = append(clones, c.cloneRR(rr))
+	}
+
+	return clones
+}
+
+// disposeRRs returns rrs' backing slice and, where possible, each RR to c's
+// pools.  It does nothing if rrs is nil.
+func (c *Cloner) disposeRRs(rrs []dns.RR) {
+	if rrs == nil {
+		return
+	}
+
+	for _, rr := range rrs {
+		c.disposeRR(rr)
+	}
+
+	c.rrPool.Put(rrs[:0])
+}
+
+// cloneRR returns a deep copy of rr, obtained from c's pools if rr's
+// concrete type is one of the pool-backed ones, or from [dns.Copy]
+// otherwise.
+func (c *Cloner) cloneRR(rr dns.RR) (clone dns.RR) {
+	switch v := rr.(type) {
+	case *dns.A:
+		a := c.aPool.Get().(*dns.A)
+		*a = *v
+		a.A = append(net.IP(nil), v.A...)
+		clone = a
+	case *dns.AAAA:
+		aaaa := c.aaaaPool.Get().(*dns.AAAA)
+		*aaaa = *v
+		aaaa.AAAA = append(net.IP(nil), v.AAAA...)
+		clone = aaaa
+	case *dns.CNAME:
+		cname := c.cnamePool.Get().(*dns.CNAME)
+		*cname = *v
+		clone = cname
+	case *dns.SOA:
+		soa := c.soaPool.Get().(*dns.SOA)
+		*soa = *v
+		clone = soa
+	case *dns.MX:
+		mx := c.mxPool.Get().(*dns.MX)
+		*mx = *v
+		clone = mx
+	case *dns.OPT:
+		opt := c.optPool.Get().(*dns.OPT)
+		*opt = *v
+		if v.Option != nil {
+			opt.Option = dns.Copy(v).(*dns.OPT).Option
+		}
+		clone = opt
+	case *dns.TXT:
+		txt := c.txtPool.Get().(*dns.TXT)
+		*txt = *v
+		txt.Txt = append([]string(nil), v.Txt...)
+		clone = txt
+	case *dns.SVCB:
+		svcb := c.svcbPool.Get().(*dns.SVCB)
+		*svcb = *v
+		svcb.Value = cloneSVCBValues(v.Value)
+		clone = svcb
+	case *dns.HTTPS:
+		https := c.httpsPool.Get().(*dns.HTTPS)
+		https.SVCB = v.SVCB
+		https.Value = cloneSVCBValues(v.Value)
+		clone = https
+	default:
+		clone = dns.Copy(rr)
+	}
+
+	return clone
+}
+
+// disposeRR returns rr to the pool it was obtained from, if its concrete
+// type is one of the pool-backed ones, resetting it to its zero value
+// first.  It does nothing for any other RR type.
+func (c *Cloner) disposeRR(rr dns.RR) {
+	switch v := rr.(type) {
+	case *dns.A:
+		*v = dns.A{}
+		c.aPool.Put(v)
+	case *dns.AAAA:
+		*v = dns.AAAA{}
+		c.aaaaPool.Put(v)
+	case *dns.CNAME:
+		*v = dns.CNAME{}
+		c.cnamePool.Put(v)
+	case *dns.SOA:
+		*v = dns.SOA{}
+		c.soaPool.Put(v)
+	case *dns.MX:
+		*v = dns.MX{}
+		c.mxPool.Put(v)
+	case *dns.OPT:
+		*v = dns.OPT{}
+		c.optPool.Put(v)
+	case *dns.TXT:
+		*v = dns.TXT{}
+		c.txtPool.Put(v)
+	case *dns.SVCB:
+		*v = dns.SVCB{}
+		c.svcbPool.Put(v)
+	case *dns.HTTPS:
+		*v = dns.HTTPS{}
+		c.httpsPool.Put(v)
+	default:
+		// Not pool-backed; nothing to do.
+	}
+}
+
+// cloneSVCBValues returns a deep copy of vals, or nil if vals is nil.
+func cloneSVCBValues(vals []dns.SVCBKeyValue) (clones []dns.SVCBKeyValue) {
+	if vals == nil {
+		return nil
+	}
+
+	clones = make([]dns.SVCBKeyValue, len(vals))
+	for i, v := range vals {
+		clones[i] = cloneSVCBValue(v)
+	}
+
+	return clones
+}
+
+// cloneSVCBValue returns a deep copy of v.  Unrecognized [dns.SVCBKeyValue]
+// implementations are returned unchanged, since this package does not know
+// how to copy their fields; in practice, all keys defined by RFC 9460 are
+// covered below.
+func cloneSVCBValue(v dns.SVCBKeyValue) (clone dns.SVCBKeyValue) {
+	switch t := v.(type) {
+	case *dns.SVCBMandatory:
+		return &dns.SVCBMandatory{Code: append([]dns.SVCBKey(nil), t.Code...)}
+	case *dns.SVCBAlpn:
+		return &dns.SVCBAlpn{Alpn: append([]string(nil), t.Alpn...)}
+	case *dns.SVCBNoDefaultAlpn:
+		return &dns.SVCBNoDefaultAlpn{}
+	case *dns.SVCBPort:
+		cp := *t
+
+		return &cp
+	case *dns.SVCBIPv4Hint:
+		return &dns.SVCBIPv4Hint{Hint: cloneIPs(t.Hint)}
+	case *dns.SVCBECHConfig:
+		return &dns.SVCBECHConfig{ECH: append([]byte(nil), t.ECH...)}
+	case *dns.SVCBIPv6Hint:
+		return &dns.SVCBIPv6Hint{Hint: cloneIPs(t.Hint)}
+	case *dns.SVCBLocal:
+		return &dns.SVCBLocal{KeyCode: t.KeyCode, Data: append([]byte(nil), t.Data...)}
+	case *dns.SVCBDoHPath:
+		return &dns.SVCBDoHPath{Template: t.Template}
+	default:
+		return v
+	}
+}
+
+// cloneIPs returns a deep copy of ips, or nil if ips is nil.
+func cloneIPs(ips []net.IP) (clones []net.IP) {
+	if ips == nil {
+		return nil
+	}
+
+	clones = make([]net.IP, len(ips))
+	for i, ip := range ips {
+		clones[i] = append(net.IP(nil), ip...)
+	}
+
+	return clones
+}
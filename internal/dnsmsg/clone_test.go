@@ -0,0 +1,118 @@
+package dnsmsg_test
+
+import (
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/dnsmsg"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClone_svcb makes sure that cloning an HTTPS record deep-copies every
+// SVCB key-value pair it carries, including [dns.SVCBDoHPath], which DDR uses
+// to advertise the DoH template path.
+func TestClone_svcb(t *testing.T) {
+	msg := (&dns.Msg{}).SetQuestion("example.com.", dns.TypeHTTPS)
+	msg.Response = true
+	msg.Answer = []dns.RR{&dns.HTTPS{
+		SVCB: dns.SVCB{
+			Hdr:      dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeHTTPS, Class: dns.ClassINET, Ttl: 300},
+			Priority: 1,
+			Target:   "example.com.",
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBAlpn{Alpn: []string{"h2", "h3"}},
+				&dns.SVCBDoHPath{Template: "/dns-query{?dns}"},
+			},
+		},
+	}}
+
+	clone := dnsmsg.Clone(msg)
+	require.Len(t, clone.Answer, 1)
+
+	https, ok := clone.Answer[0].(*dns.HTTPS)
+	require.True(t, ok)
+	require.Len(t, https.Value, 2)
+
+	dohPath, ok := https.Value[1].(*dns.SVCBDoHPath)
+	require.True(t, ok)
+	assert.Equal(t, "/dns-query{?dns}", dohPath.Template)
+
+	// Mutate the clone's SVCBDoHPath and make sure the original is
+	// unaffected, proving it isn't merely aliased.
+	dohPath.Template = "/mutated"
+
+	origHTTPS := msg.Answer[0].(*dns.HTTPS)
+	origDoHPath := origHTTPS.Value[1].(*dns.SVCBDoHPath)
+	assert.Equal(t, "/dns-query{?dns}", origDoHPath.Template)
+}
+
+// newBenchMsg returns a representative response message exercising the
+// pool-backed RR types, for use in benchmarks.
+func newBenchMsg() (msg *dns.Msg) {
+	msg = (&dns.Msg{}).SetQuestion("example.com.", dns.TypeA)
+	msg.Response = true
+
+	msg.Answer = []dns.RR{
+		&dns.A{
+			Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+			A:   []byte{1, 2, 3, 4},
+		},
+		&dns.CNAME{
+			Hdr:    dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300},
+			Target: "cdn.example.com.",
+		},
+		&dns.TXT{
+			Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300},
+			Txt: []string{"v=spf1", "-all"},
+		},
+	}
+
+	msg.Ns = []dns.RR{&dns.SOA{
+		Hdr:     dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+		Ns:      "ns1.example.com.",
+		Mbox:    "hostmaster.example.com.",
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  300,
+	}}
+
+	msg.Extra = []dns.RR{&dns.OPT{
+		Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT},
+	}}
+
+	return msg
+}
+
+func BenchmarkClone(b *testing.B) {
+	msg := newBenchMsg()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		clone := dnsmsg.Clone(msg)
+		_ = clone
+	}
+}
+
+func BenchmarkCloner(b *testing.B) {
+	msg := newBenchMsg()
+	c := dnsmsg.NewCloner()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		clone := c.Clone(msg)
+		c.Dispose(clone)
+	}
+}
+
+func BenchmarkMsgCopy(b *testing.B) {
+	msg := newBenchMsg()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		clone := msg.Copy()
+		_ = clone
+	}
+}
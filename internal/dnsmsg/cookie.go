@@ -0,0 +1,278 @@
+package dnsmsg
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/netip"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNS Cookies (EDNS0_COOKIE)
+//
+// See https://datatracker.ietf.org/doc/html/rfc7873.
+
+// Cookie lengths, in bytes, per RFC 7873 §4.
+const (
+	cookieClientLen    = 8
+	cookieServerMinLen = 8
+	cookieServerMaxLen = 32
+)
+
+// SetClientCookie sets msg's EDNS0 Cookie option to client, creating the EDNS
+// OPT pseudosection with [DefaultEDNSUDPSize] if msg doesn't have one yet,
+// and replacing any previous Cookie option rather than duplicating it.  Any
+// server cookie previously present in msg is discarded, since a fresh client
+// cookie invalidates it anyway.  msg must not be nil.
+func SetClientCookie(msg *dns.Msg, client [8]byte) {
+	setCookie(msg, client, nil)
+}
+
+// SetServerCookie sets msg's EDNS0 Cookie option to carry both the client
+// cookie already present in msg (or eight zero bytes, if msg has none) and
+// server, replacing any previous Cookie option rather than duplicating it.
+// server must be between 8 and 32 bytes long.  msg must not be nil.
+func SetServerCookie(msg *dns.Msg, server []byte) (err error) {
+	if l := len(server); l < cookieServerMinLen || l > cookieServerMaxLen {
+		return fmt.Errorf("dnsmsg: bad server cookie length %d", l)
+	}
+
+	var client [8]byte
+	if c, _, ok, cErr := CookiesFromMsg(msg); cErr == nil && ok {
+		client = c
+	}
+
+	setCookie(msg, client, server)
+
+	return nil
+}
+
+// setCookie replaces msg's EDNS0 Cookie option with one built from client
+// and server, creating the EDNS OPT pseudosection with [DefaultEDNSUDPSize]
+// if necessary.
+func setCookie(msg *dns.Msg, client [8]byte, server []byte) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		msg.SetEdns0(DefaultEDNSUDPSize, false)
+		opt = msg.IsEdns0()
+	}
+
+	opts := opt.Option[:0]
+	for _, o := range opt.Option {
+		if _, ok := o.(*dns.EDNS0_COOKIE); ok {
+			continue
+		}
+
+		opts = append(opts, o)
+	}
+
+	opt.Option = append(opts, &dns.EDNS0_COOKIE{
+		Code:   dns.EDNS0COOKIE,
+		Cookie: hex.EncodeToString(client[:]) + hex.EncodeToString(server),
+	})
+}
+
+// CookiesFromMsg returns the client and, if present, server cookie from
+// msg's EDNS0 Cookie option.  ok is false if msg has no Cookie option.  err
+// is non-nil only if msg has a malformed one.  msg must not be nil.
+func CookiesFromMsg(msg *dns.Msg) (client [8]byte, server []byte, ok bool, err error) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return client, nil, false, nil
+	}
+
+	for _, o := range opt.Option {
+		c, isCookie := o.(*dns.EDNS0_COOKIE)
+		if !isCookie {
+			continue
+		}
+
+		var raw []byte
+		raw, err = hex.DecodeString(c.Cookie)
+		if err != nil {
+			return client, nil, false, fmt.Errorf("dnsmsg: bad cookie encoding: %w", err)
+		}
+
+		l := len(raw)
+		if l != cookieClientLen &&
+			(l < cookieClientLen+cookieServerMinLen || l > cookieClientLen+cookieServerMaxLen) {
+			return client, nil, false, fmt.Errorf("dnsmsg: bad cookie length %d", l)
+		}
+
+		copy(client[:], raw[:cookieClientLen])
+		if l > cookieClientLen {
+			server = raw[cookieClientLen:]
+		}
+
+		return client, server, true, nil
+	}
+
+	return client, nil, false, nil
+}
+
+// Server-cookie construction and validation (RFC 9018)
+//
+// See https://datatracker.ietf.org/doc/html/rfc9018#section-4.
+
+// serverCookieVersion is the Version octet of the interoperable server
+// cookie.
+const serverCookieVersion = 1
+
+// serverCookieLen is the length, in bytes, of a server cookie built per the
+// interoperable construction: 1 version + 3 reserved + 4 timestamp + 8 hash.
+const serverCookieLen = 16
+
+// cookieSecretLen is the required key length, in bytes, for SipHash-2-4.
+const cookieSecretLen = 16
+
+// cookieFreshness is the maximum age, in either direction, that a server
+// cookie's timestamp may have for [ValidateServerCookie] to still consider it
+// valid.
+const cookieFreshness = 1 * time.Hour
+
+// NewServerCookie builds a fresh, interoperable server cookie for client, as
+// seen from clientIP, keyed by secret and timestamped at ts.  secret must be
+// exactly 16 bytes, the key size SipHash-2-4 requires; rotate secret
+// periodically to bound the damage of a leaked key.
+func NewServerCookie(secret []byte, client [8]byte, clientIP netip.Addr, ts time.Time) (
+	server []byte,
+	err error,
+) {
+	if len(secret) != cookieSecretLen {
+		return nil, fmt.Errorf("dnsmsg: bad cookie secret length %d, want %d", len(secret), cookieSecretLen)
+	}
+
+	var hdr [8]byte
+	hdr[0] = serverCookieVersion
+	binary.BigEndian.PutUint32(hdr[4:8], uint32(ts.Unix()))
+
+	hash := siphash24(secret, cookieHashInput(client, hdr, clientIP))
+
+	server = make([]byte, serverCookieLen)
+	copy(server, hdr[:])
+	binary.BigEndian.PutUint64(server[8:], hash)
+
+	return server, nil
+}
+
+// cookieHashInput builds the data hashed for the interoperable server-cookie
+// construction: Client Cookie || Version || Reserved || Timestamp || Client
+// IP, see RFC 9018 §4.
+func cookieHashInput(client [8]byte, hdr [8]byte, clientIP netip.Addr) (data []byte) {
+	ip := clientIP.AsSlice()
+	data = make([]byte, 0, len(client)+len(hdr)+len(ip))
+	data = append(data, client[:]...)
+	data = append(data, hdr[:]...)
+	data = append(data, ip...)
+
+	return data
+}
+
+// ValidateServerCookie verifies that msg carries a server cookie that this
+// server produced for clientIP using secret, and that the cookie's
+// timestamp is still within [cookieFreshness] of now.  msg must not be nil.
+func ValidateServerCookie(
+	msg *dns.Msg,
+	secret []byte,
+	clientIP netip.Addr,
+	now time.Time,
+) (err error) {
+	client, server, ok, err := CookiesFromMsg(msg)
+	if err != nil {
+		return fmt.Errorf("dnsmsg: reading cookie: %w", err)
+	} else if !ok {
+		return errors.New("dnsmsg: no cookie")
+	} else if len(server) != serverCookieLen {
+		return fmt.Errorf("dnsmsg: bad server cookie length %d", len(server))
+	}
+
+	ts := time.Unix(int64(binary.BigEndian.Uint32(server[4:8])), 0)
+	if d := now.Sub(ts); d < -cookieFreshness || d > cookieFreshness {
+		return fmt.Errorf("dnsmsg: stale server cookie timestamped %s", ts)
+	}
+
+	want, err := NewServerCookie(secret, client, clientIP, ts)
+	if err != nil {
+		return fmt.Errorf("dnsmsg: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare(want, server) != 1 {
+		return errors.New("dnsmsg: invalid server cookie")
+	}
+
+	return nil
+}
+
+// siphash24 is a minimal implementation of SipHash-2-4 (2 compression
+// rounds, 4 finalization rounds) as used by the interoperable DNS Cookie
+// construction.  key must be 16 bytes.
+//
+// See https://www.aumasson.jp/siphash/siphash.pdf.
+func siphash24(key []byte, data []byte) (sum uint64) {
+	k0 := binary.LittleEndian.Uint64(key[0:8])
+	k1 := binary.LittleEndian.Uint64(key[8:16])
+
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+
+	b := uint64(len(data)) << 56
+
+	for len(data) >= 8 {
+		m := binary.LittleEndian.Uint64(data)
+
+		v3 ^= m
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+		v0 ^= m
+
+		data = data[8:]
+	}
+
+	var last [8]byte
+	copy(last[:], data)
+	b |= binary.LittleEndian.Uint64(last[:])
+
+	v3 ^= b
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0 ^= b
+
+	v2 ^= 0xff
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+	v0, v1, v2, v3 = sipRound(v0, v1, v2, v3)
+
+	return v0 ^ v1 ^ v2 ^ v3
+}
+
+// sipRound performs one SipHash round on v0..v3, returning the updated
+// state.
+func sipRound(v0, v1, v2, v3 uint64) (r0, r1, r2, r3 uint64) {
+	v0 += v1
+	v1 = bits.RotateLeft64(v1, 13)
+	v1 ^= v0
+	v0 = bits.RotateLeft64(v0, 32)
+
+	v2 += v3
+	v3 = bits.RotateLeft64(v3, 16)
+	v3 ^= v2
+
+	v0 += v3
+	v3 = bits.RotateLeft64(v3, 21)
+	v3 ^= v0
+
+	v2 += v1
+	v1 = bits.RotateLeft64(v1, 17)
+	v1 ^= v2
+	v2 = bits.RotateLeft64(v2, 32)
+
+	return v0, v1, v2, v3
+}
@@ -6,6 +6,7 @@ package dnsmsg
 
 import (
 	"fmt"
+	"math/rand"
 	"net/netip"
 
 	"github.com/AdguardTeam/AdGuardDNS/internal/agdnet"
@@ -37,34 +38,25 @@ const DefaultEDNSUDPSize = 4096
 // See also https://datatracker.ietf.org/doc/html/rfc6763#section-6.1.
 const MaxTXTStringLen int = 255
 
+// defaultCloner is the package-level [Cloner] backing the package-level
+// [Clone] function.
+var defaultCloner = NewCloner()
+
 // Clone returns a new *Msg which is a deep copy of msg.  Use this instead of
-// msg.Copy, because the latter does not actually produce a deep copy of msg.
-//
-// See https://github.com/miekg/dns/issues/1351.
+// msg.Copy, because the latter does not actually produce a deep copy of msg;
+// see https://github.com/miekg/dns/issues/1351.
 //
-// TODO(a.garipov): See if we can also decrease allocations for such cases by
-// modifying more of the original code.
+// Clone is a thin wrapper around a shared, package-level [Cloner] and does
+// not return the clone's components to any pool once the caller is done with
+// it.  Callers that clone many messages, such as on every incoming request,
+// should instead keep their own *Cloner and pair [Cloner.Clone] with
+// [Cloner.Dispose] to actually reap the reduced-allocation benefit.
 func Clone(msg *dns.Msg) (clone *dns.Msg) {
 	if msg == nil {
 		return nil
 	}
 
-	clone = msg.Copy()
-
-	// Make sure that nilness of the RR slices is retained.
-	if msg.Answer == nil {
-		clone.Answer = nil
-	}
-
-	if msg.Ns == nil {
-		clone.Ns = nil
-	}
-
-	if msg.Extra == nil {
-		clone.Extra = nil
-	}
-
-	return clone
+	return defaultCloner.Clone(msg)
 }
 
 // IsDO returns true if msg has an EDNS option pseudosection and that
@@ -103,6 +95,400 @@ func ECSFromMsg(msg *dns.Msg) (subnet netip.Prefix, scope uint8, err error) {
 	return netip.Prefix{}, 0, nil
 }
 
+// ECSOpt returns a new EDNS Client Subnet option describing subnet and scope.
+// subnet must already be masked, see [netip.Prefix.Masked], and its address
+// family must be either IPv4 or IPv6.
+func ECSOpt(subnet netip.Prefix, scope uint8) (esn *dns.EDNS0_SUBNET, err error) {
+	if !subnet.IsValid() {
+		return nil, fmt.Errorf("bad subnet %s", subnet)
+	} else if subnet.Masked() != subnet {
+		return nil, fmt.Errorf("subnet %s is not masked", subnet)
+	}
+
+	addr := subnet.Addr()
+
+	var fam agdnet.AddrFamily
+	switch {
+	case addr.Is4():
+		fam = agdnet.AddrFamilyIPv4
+	case addr.Is6():
+		fam = agdnet.AddrFamilyIPv6
+	default:
+		return nil, fmt.Errorf("unsupported addr family for %s", addr)
+	}
+
+	return &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        uint16(fam),
+		SourceNetmask: uint8(subnet.Bits()),
+		SourceScope:   scope,
+		Address:       addr.AsSlice(),
+	}, nil
+}
+
+// AddECSOpt adds subnet and scope to opt as an EDNS Client Subnet option,
+// replacing any previous EDNS Client Subnet option in opt rather than
+// duplicating it.  opt must not be nil.  subnet must already be masked, see
+// [netip.Prefix.Masked].
+func AddECSOpt(opt *dns.OPT, subnet netip.Prefix, scope uint8) (err error) {
+	esn, err := ECSOpt(subnet, scope)
+	if err != nil {
+		return fmt.Errorf("bad ecs data: %w", err)
+	}
+
+	opt.Option = append(withoutECSOpt(opt), esn)
+
+	return nil
+}
+
+// SetECS sets the EDNS Client Subnet option on msg to subnet and scope,
+// creating the EDNS OPT pseudosection with [DefaultEDNSUDPSize] if msg
+// doesn't have one yet, and replacing any previous EDNS Client Subnet option
+// rather than duplicating it.  msg must not be nil.  subnet must already be
+// masked, see [netip.Prefix.Masked].
+func SetECS(msg *dns.Msg, subnet netip.Prefix, scope uint8) (err error) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		msg.SetEdns0(DefaultEDNSUDPSize, false)
+		opt = msg.IsEdns0()
+	}
+
+	err = AddECSOpt(opt, subnet, scope)
+	if err != nil {
+		return fmt.Errorf("setting ecs: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveECS removes any EDNS Client Subnet option from msg's EDNS OPT
+// pseudosection.  msg must not be nil.  It does nothing if msg doesn't have
+// an EDNS OPT pseudosection.
+func RemoveECS(msg *dns.Msg) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return
+	}
+
+	opt.Option = withoutECSOpt(opt)
+}
+
+// withoutECSOpt returns opt's options with any EDNS Client Subnet option
+// removed.  The returned slice shares opt.Option's underlying array.
+func withoutECSOpt(opt *dns.OPT) (opts []dns.EDNS0) {
+	opts = opt.Option[:0]
+	for _, o := range opt.Option {
+		if _, ok := o.(*dns.EDNS0_SUBNET); ok {
+			continue
+		}
+
+		opts = append(opts, o)
+	}
+
+	return opts
+}
+
+// TruncateECS truncates subnet to v4Bits or v6Bits of prefix length,
+// depending on its address family, and masks off any resulting host bits.
+// If its prefix is already no longer than the applicable maximum, the prefix
+// length is kept, but host bits beyond it are still masked off.
+func TruncateECS(subnet netip.Prefix, v4Bits, v6Bits uint8) (truncated netip.Prefix) {
+	if !subnet.IsValid() {
+		return subnet
+	}
+
+	maxBits := int(v4Bits)
+	if subnet.Addr().Is6() {
+		maxBits = int(v6Bits)
+	}
+
+	bits := subnet.Bits()
+	if bits > maxBits {
+		bits = maxBits
+	}
+
+	return netip.PrefixFrom(subnet.Addr(), bits).Masked()
+}
+
+// Policy configures how [ApplyECSPolicy] reconciles RFC 7871
+// CDN-friendliness with an operator's privacy requirements for a particular
+// upstream.
+type Policy struct {
+	// MaxV4Prefix is the maximum IPv4 ECS prefix length to forward; longer,
+	// more specific prefixes are truncated to this length by [TruncateECS].
+	MaxV4Prefix uint8
+
+	// MaxV6Prefix is the maximum IPv6 ECS prefix length to forward; longer,
+	// more specific prefixes are truncated to this length by [TruncateECS].
+	MaxV6Prefix uint8
+
+	// ScrubPrivate, if true, drops the ECS option entirely when the source
+	// subnet is a loopback or link-local address.
+	ScrubPrivate bool
+
+	// DropForRFC1918, if true, drops the ECS option entirely when the
+	// source subnet is a private address, see [netip.Addr.IsPrivate].
+	DropForRFC1918 bool
+}
+
+// ApplyECSPolicy reads the EDNS Client Subnet option from msg, if any, and
+// reconciles it with p: the option is either dropped entirely, per
+// ScrubPrivate and DropForRFC1918, or truncated to p's configured prefix
+// lengths via [TruncateECS].  Either way, the result replaces any existing
+// ECS option in msg.  applied is the zero [netip.Prefix] if msg had no ECS
+// option to begin with or the option was dropped.  msg must not be nil.
+func ApplyECSPolicy(msg *dns.Msg, p Policy) (applied netip.Prefix, err error) {
+	subnet, scope, err := ECSFromMsg(msg)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("reading ecs: %w", err)
+	}
+
+	if subnet == (netip.Prefix{}) {
+		return netip.Prefix{}, nil
+	}
+
+	addr := subnet.Addr()
+	if p.ScrubPrivate && (addr.IsLoopback() || addr.IsLinkLocalUnicast()) {
+		RemoveECS(msg)
+
+		return netip.Prefix{}, nil
+	}
+
+	if p.DropForRFC1918 && addr.IsPrivate() {
+		RemoveECS(msg)
+
+		return netip.Prefix{}, nil
+	}
+
+	applied = TruncateECS(subnet, p.MaxV4Prefix, p.MaxV6Prefix)
+
+	err = SetECS(msg, applied, scope)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("applying ecs policy: %w", err)
+	}
+
+	return applied, nil
+}
+
+// ExtendedError is the parsed information from an EDNS0 Extended DNS Error
+// (EDE) option.
+//
+// See https://datatracker.ietf.org/doc/html/rfc8914.
+type ExtendedError struct {
+	// ExtraText is the optional, human-readable EDE EXTRA-TEXT.
+	ExtraText string
+
+	// InfoCode is the EDE INFO-CODE; see the ExtraCode* constants.
+	InfoCode uint16
+}
+
+// Extended DNS Error INFO-CODEs from the IANA registry.
+//
+// See https://www.iana.org/assignments/dns-parameters/dns-parameters.xhtml#extended-dns-error-codes.
+const (
+	ExtraCodeOther                uint16 = 0
+	ExtraCodeUnsupportedDNSKeyAlg uint16 = 1
+	ExtraCodeUnsupportedDSDigest  uint16 = 2
+	ExtraCodeStaleAnswer          uint16 = 3
+	ExtraCodeForgedAnswer         uint16 = 4
+	ExtraCodeDNSSECIndeterminate  uint16 = 5
+	ExtraCodeDNSSECBogus          uint16 = 6
+	ExtraCodeSignatureExpired     uint16 = 7
+	ExtraCodeSignatureNotYetValid uint16 = 8
+	ExtraCodeDNSKeyMissing        uint16 = 9
+	ExtraCodeRRSIGsMissing        uint16 = 10
+	ExtraCodeNoZoneKeyBitSet      uint16 = 11
+	ExtraCodeNSECMissing          uint16 = 12
+	ExtraCodeCachedError          uint16 = 13
+	ExtraCodeNotReady             uint16 = 14
+	ExtraCodeBlocked              uint16 = 15
+	ExtraCodeCensored             uint16 = 16
+	ExtraCodeFiltered             uint16 = 17
+	ExtraCodeProhibited           uint16 = 18
+	ExtraCodeStaleNXDOMAINAnswer  uint16 = 19
+	ExtraCodeNotAuthoritative     uint16 = 20
+	ExtraCodeNotSupported         uint16 = 21
+	ExtraCodeNoReachableAuthority uint16 = 22
+	ExtraCodeNetworkError         uint16 = 23
+	ExtraCodeInvalidData          uint16 = 24
+)
+
+// SetEDE appends an Extended DNS Error (EDE) option with the given info code
+// and, optionally, human-readable extra text to msg's EDNS OPT
+// pseudosection, creating the pseudosection with [DefaultEDNSUDPSize] if msg
+// doesn't have one yet.  extra is truncated, byte by byte, if necessary, so
+// that msg still packs within the negotiated EDNS UDP size.  msg must not be
+// nil.
+func SetEDE(msg *dns.Msg, code uint16, extra string) (err error) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		msg.SetEdns0(DefaultEDNSUDPSize, false)
+		opt = msg.IsEdns0()
+	}
+
+	ede := &dns.EDNS0_EDE{
+		InfoCode:  code,
+		ExtraText: extra,
+	}
+	opt.Option = append(opt.Option, ede)
+
+	budget := int(opt.UDPSize())
+	for len(ede.ExtraText) > 0 && msg.Len() > budget {
+		ede.ExtraText = ede.ExtraText[:len(ede.ExtraText)-1]
+	}
+
+	return nil
+}
+
+// EDEFromMsg returns all Extended DNS Error options from msg's EDNS OPT
+// pseudosection, in the order in which they appear.  It returns nil if msg
+// has no EDNS OPT pseudosection or no EDE options.  msg must not be nil.
+func EDEFromMsg(msg *dns.Msg) (errs []ExtendedError, err error) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return nil, nil
+	}
+
+	for _, o := range opt.Option {
+		ede, ok := o.(*dns.EDNS0_EDE)
+		if !ok {
+			continue
+		}
+
+		errs = append(errs, ExtendedError{
+			ExtraText: ede.ExtraText,
+			InfoCode:  ede.InfoCode,
+		})
+	}
+
+	return errs, nil
+}
+
+// Recommended padding block sizes for DNS messages sent over encrypted
+// transports.
+//
+// See https://datatracker.ietf.org/doc/html/rfc8467#section-4.1.
+const (
+	PaddingBlockQuery    = 128
+	PaddingBlockResponse = 468
+)
+
+// paddingOptionOverhead is the number of bytes an EDNS0 Padding option itself
+// adds to a message: 2 bytes for OPTION-CODE plus 2 bytes for OPTION-LENGTH.
+const paddingOptionOverhead = 4
+
+// PaddingStrategy decides how much a DNS message should be padded.
+type PaddingStrategy interface {
+	// padLen returns the desired total wire-format length, in bytes, that a
+	// message of length msgLen should be padded up to.  It may return a
+	// value less than or equal to msgLen, in which case no padding is added.
+	padLen(msgLen int) (total int)
+}
+
+// PaddingBlockLength is a [PaddingStrategy] that pads a message up to the
+// next multiple of Block bytes, as recommended by RFC 8467; see
+// [PaddingBlockQuery] and [PaddingBlockResponse].
+//
+// See https://datatracker.ietf.org/doc/html/rfc8467.
+type PaddingBlockLength struct {
+	// Block is the block size, in bytes, to pad up to.  Block must be
+	// greater than zero.
+	Block int
+}
+
+// padLen implements the [PaddingStrategy] interface for PaddingBlockLength.
+func (p PaddingBlockLength) padLen(msgLen int) (total int) {
+	return (msgLen + p.Block - 1) / p.Block * p.Block
+}
+
+// PaddingRandom is a [PaddingStrategy] that pads a message with a
+// pseudorandom number of bytes, uniformly distributed in [0, Max], to avoid
+// the fixed message lengths that [PaddingBlockLength] would otherwise
+// produce.
+type PaddingRandom struct {
+	// Max is the maximum number of padding bytes to add.  Max must be
+	// greater than or equal to zero.
+	Max int
+}
+
+// padLen implements the [PaddingStrategy] interface for PaddingRandom.
+func (p PaddingRandom) padLen(msgLen int) (total int) {
+	if p.Max <= 0 {
+		return msgLen
+	}
+
+	return msgLen + rand.Intn(p.Max+1)
+}
+
+// Pad appends an EDNS0 Padding option to msg's EDNS OPT pseudosection,
+// creating the pseudosection with [DefaultEDNSUDPSize] if msg doesn't have
+// one yet, so that msg's wire-format length matches the length chosen by
+// strategy.  The resulting length is clamped so that it never exceeds
+// [DefaultEDNSUDPSize] or, if smaller, the UDP size already negotiated in
+// msg's EDNS OPT record.  msg must not be nil.
+//
+// See https://datatracker.ietf.org/doc/html/rfc7830 and
+// https://datatracker.ietf.org/doc/html/rfc8467.
+func Pad(msg *dns.Msg, strategy PaddingStrategy) (err error) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		msg.SetEdns0(DefaultEDNSUDPSize, false)
+		opt = msg.IsEdns0()
+	}
+
+	maxLen := DefaultEDNSUDPSize
+	if udpSize := int(opt.UDPSize()); udpSize > 0 && udpSize < maxLen {
+		maxLen = udpSize
+	}
+
+	curLen := msg.Len()
+
+	// Ask the strategy to round up the length the message will have *after*
+	// the Padding option itself is added, so the final wire length actually
+	// lands on the strategy's target instead of overshooting it by
+	// paddingOptionOverhead.
+	target := strategy.padLen(curLen + paddingOptionOverhead)
+	if target > maxLen {
+		target = maxLen
+	}
+
+	padLen := target - curLen - paddingOptionOverhead
+	if padLen < 0 {
+		// There isn't enough room left under maxLen to add the option at
+		// all, not even with zero padding bytes; adding it anyway would
+		// push the wire length over maxLen.
+		return nil
+	}
+
+	opt.Option = append(opt.Option, &dns.EDNS0_PADDING{
+		Padding: make([]byte, padLen),
+	})
+
+	return nil
+}
+
+// StripPadding removes any EDNS0 Padding option from msg's EDNS OPT
+// pseudosection.  It is primarily useful in tests that compare messages
+// regardless of padding.  msg must not be nil.  It does nothing if msg
+// doesn't have an EDNS OPT pseudosection.
+func StripPadding(msg *dns.Msg) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return
+	}
+
+	opts := opt.Option[:0]
+	for _, o := range opt.Option {
+		if _, ok := o.(*dns.EDNS0_PADDING); ok {
+			continue
+		}
+
+		opts = append(opts, o)
+	}
+
+	opt.Option = opts
+}
+
 // ecsData returns the subnet and scope information from an EDNS Client Subnet
 // option.  It returns an error if esn does not contain valid, RFC-compliant
 // EDNS Client Subnet information or the address family is unsupported.
@@ -0,0 +1,344 @@
+package dnsmsg_test
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/dnsmsg"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestMsg returns a minimal response message without an EDNS OPT
+// pseudosection, for use in tests that add one and further EDNS options to
+// it.
+func newTestMsg() (msg *dns.Msg) {
+	msg = (&dns.Msg{}).SetQuestion("example.com.", dns.TypeA)
+	msg.Response = true
+
+	return msg
+}
+
+func TestTruncateECS(t *testing.T) {
+	v4 := netip.MustParsePrefix("1.2.3.4/32")
+	v6 := netip.MustParsePrefix("2001:db8::1/128")
+
+	testCases := []struct {
+		name string
+		in   netip.Prefix
+		want netip.Prefix
+	}{{
+		name: "v4_truncated",
+		in:   v4,
+		want: netip.MustParsePrefix("1.2.3.0/24"),
+	}, {
+		name: "v4_already_short",
+		in:   netip.MustParsePrefix("1.2.0.0/16"),
+		want: netip.MustParsePrefix("1.2.0.0/16"),
+	}, {
+		name: "v6_truncated",
+		in:   v6,
+		want: netip.MustParsePrefix("2001:db8::/56"),
+	}, {
+		name: "invalid",
+		in:   netip.Prefix{},
+		want: netip.Prefix{},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := dnsmsg.TruncateECS(tc.in, 24, 56)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestApplyECSPolicy(t *testing.T) {
+	t.Run("no_ecs", func(t *testing.T) {
+		msg := newTestMsg()
+
+		applied, err := dnsmsg.ApplyECSPolicy(msg, dnsmsg.Policy{MaxV4Prefix: 24, MaxV6Prefix: 56})
+		require.NoError(t, err)
+
+		assert.Equal(t, netip.Prefix{}, applied)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		msg := newTestMsg()
+		require.NoError(t, dnsmsg.SetECS(msg, netip.MustParsePrefix("1.2.3.4/32"), 0))
+
+		applied, err := dnsmsg.ApplyECSPolicy(msg, dnsmsg.Policy{MaxV4Prefix: 24, MaxV6Prefix: 56})
+		require.NoError(t, err)
+
+		assert.Equal(t, netip.MustParsePrefix("1.2.3.0/24"), applied)
+
+		gotSubnet, _, err := dnsmsg.ECSFromMsg(msg)
+		require.NoError(t, err)
+		assert.Equal(t, applied, gotSubnet)
+	})
+
+	t.Run("scrub_private", func(t *testing.T) {
+		msg := newTestMsg()
+		require.NoError(t, dnsmsg.SetECS(msg, netip.MustParsePrefix("127.0.0.1/32"), 0))
+
+		applied, err := dnsmsg.ApplyECSPolicy(msg, dnsmsg.Policy{
+			MaxV4Prefix:  24,
+			MaxV6Prefix:  56,
+			ScrubPrivate: true,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, netip.Prefix{}, applied)
+
+		gotSubnet, _, err := dnsmsg.ECSFromMsg(msg)
+		require.NoError(t, err)
+		assert.Equal(t, netip.Prefix{}, gotSubnet)
+	})
+
+	t.Run("drop_rfc1918", func(t *testing.T) {
+		msg := newTestMsg()
+		require.NoError(t, dnsmsg.SetECS(msg, netip.MustParsePrefix("10.0.0.1/32"), 0))
+
+		applied, err := dnsmsg.ApplyECSPolicy(msg, dnsmsg.Policy{
+			MaxV4Prefix:    24,
+			MaxV6Prefix:    56,
+			DropForRFC1918: true,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, netip.Prefix{}, applied)
+	})
+}
+
+func TestSetEDE(t *testing.T) {
+	t.Run("round_trip", func(t *testing.T) {
+		msg := newTestMsg()
+
+		err := dnsmsg.SetEDE(msg, dnsmsg.ExtraCodeFiltered, "blocked by filter")
+		require.NoError(t, err)
+
+		got, err := dnsmsg.EDEFromMsg(msg)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+
+		assert.Equal(t, dnsmsg.ExtraCodeFiltered, got[0].InfoCode)
+		assert.Equal(t, "blocked by filter", got[0].ExtraText)
+	})
+
+	t.Run("no_ede", func(t *testing.T) {
+		msg := newTestMsg()
+
+		got, err := dnsmsg.EDEFromMsg(msg)
+		require.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("extra_text_truncated", func(t *testing.T) {
+		msg := newTestMsg()
+		msg.SetEdns0(128, false)
+
+		hugeText := make([]byte, 1024)
+		for i := range hugeText {
+			hugeText[i] = 'a'
+		}
+
+		err := dnsmsg.SetEDE(msg, dnsmsg.ExtraCodeOther, string(hugeText))
+		require.NoError(t, err)
+
+		assert.LessOrEqual(t, msg.Len(), 128)
+	})
+}
+
+func TestPad(t *testing.T) {
+	t.Run("block_length", func(t *testing.T) {
+		msg := newTestMsg()
+
+		err := dnsmsg.Pad(msg, dnsmsg.PaddingBlockLength{Block: dnsmsg.PaddingBlockResponse})
+		require.NoError(t, err)
+
+		assert.Zero(t, msg.Len()%dnsmsg.PaddingBlockResponse)
+
+		dnsmsg.StripPadding(msg)
+		opt := msg.IsEdns0()
+		require.NotNil(t, opt)
+
+		for _, o := range opt.Option {
+			_, ok := o.(*dns.EDNS0_PADDING)
+			assert.False(t, ok)
+		}
+	})
+
+	t.Run("clamped_to_udp_size", func(t *testing.T) {
+		msg := newTestMsg()
+		msg.SetEdns0(128, false)
+
+		err := dnsmsg.Pad(msg, dnsmsg.PaddingBlockLength{Block: 4096})
+		require.NoError(t, err)
+
+		assert.LessOrEqual(t, msg.Len(), 128)
+	})
+
+	t.Run("empty_padding_when_already_aligned", func(t *testing.T) {
+		msg := newTestMsg()
+		msg.SetEdns0(dnsmsg.DefaultEDNSUDPSize, false)
+
+		before := msg.Len()
+
+		err := dnsmsg.Pad(msg, dnsmsg.PaddingBlockLength{Block: 1})
+		require.NoError(t, err)
+
+		opt := msg.IsEdns0()
+		require.NotNil(t, opt)
+		require.Len(t, opt.Option, 1)
+
+		padding, ok := opt.Option[0].(*dns.EDNS0_PADDING)
+		require.True(t, ok)
+		assert.Empty(t, padding.Padding)
+		assert.Equal(t, before+4, msg.Len())
+	})
+
+	t.Run("curlen_at_block_boundary", func(t *testing.T) {
+		msg := newTestMsg()
+		msg.SetEdns0(dnsmsg.DefaultEDNSUDPSize, false)
+
+		// Use the message's own current length as the block size, so that
+		// curLen is, trivially, already a multiple of Block.  The Padding
+		// option's own overhead must still be accounted for, or the final
+		// wire length ends up four bytes past the block boundary.
+		block := msg.Len()
+
+		err := dnsmsg.Pad(msg, dnsmsg.PaddingBlockLength{Block: block})
+		require.NoError(t, err)
+
+		assert.Zero(t, msg.Len()%block)
+	})
+}
+
+func TestCookies(t *testing.T) {
+	t.Run("client_only", func(t *testing.T) {
+		msg := newTestMsg()
+		client := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+		dnsmsg.SetClientCookie(msg, client)
+
+		gotClient, gotServer, ok, err := dnsmsg.CookiesFromMsg(msg)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		assert.Equal(t, client, gotClient)
+		assert.Empty(t, gotServer)
+	})
+
+	t.Run("server_cookie_round_trip", func(t *testing.T) {
+		msg := newTestMsg()
+		client := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+		dnsmsg.SetClientCookie(msg, client)
+
+		secret := make([]byte, 16)
+		for i := range secret {
+			secret[i] = byte(i)
+		}
+
+		clientIP := netip.MustParseAddr("192.0.2.1")
+		now := time.Unix(1_700_000_000, 0)
+
+		server, err := dnsmsg.NewServerCookie(secret, client, clientIP, now)
+		require.NoError(t, err)
+
+		err = dnsmsg.SetServerCookie(msg, server)
+		require.NoError(t, err)
+
+		err = dnsmsg.ValidateServerCookie(msg, secret, clientIP, now)
+		assert.NoError(t, err)
+	})
+
+	t.Run("stale_server_cookie", func(t *testing.T) {
+		msg := newTestMsg()
+		client := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+		dnsmsg.SetClientCookie(msg, client)
+
+		secret := make([]byte, 16)
+		clientIP := netip.MustParseAddr("192.0.2.1")
+		issued := time.Unix(1_700_000_000, 0)
+
+		server, err := dnsmsg.NewServerCookie(secret, client, clientIP, issued)
+		require.NoError(t, err)
+
+		err = dnsmsg.SetServerCookie(msg, server)
+		require.NoError(t, err)
+
+		farFuture := issued.Add(2 * time.Hour)
+		err = dnsmsg.ValidateServerCookie(msg, secret, clientIP, farFuture)
+		assert.Error(t, err)
+	})
+
+	t.Run("wrong_secret", func(t *testing.T) {
+		msg := newTestMsg()
+		client := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
+		dnsmsg.SetClientCookie(msg, client)
+
+		secret := make([]byte, 16)
+		otherSecret := make([]byte, 16)
+		otherSecret[0] = 1
+
+		clientIP := netip.MustParseAddr("192.0.2.1")
+		now := time.Unix(1_700_000_000, 0)
+
+		server, err := dnsmsg.NewServerCookie(secret, client, clientIP, now)
+		require.NoError(t, err)
+
+		err = dnsmsg.SetServerCookie(msg, server)
+		require.NoError(t, err)
+
+		err = dnsmsg.ValidateServerCookie(msg, otherSecret, clientIP, now)
+		assert.Error(t, err)
+	})
+}
+
+func TestClone_nilness(t *testing.T) {
+	msg := newTestMsg()
+	require.Nil(t, msg.Answer)
+	require.Nil(t, msg.Ns)
+	require.Nil(t, msg.Extra)
+
+	clone := dnsmsg.Clone(msg)
+	assert.Nil(t, clone.Answer)
+	assert.Nil(t, clone.Ns)
+	assert.Nil(t, clone.Extra)
+
+	msg.Answer = []dns.RR{&dns.A{
+		Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		A:   []byte{1, 2, 3, 4},
+	}}
+
+	clone = dnsmsg.Clone(msg)
+	require.Len(t, clone.Answer, 1)
+	assert.NotSame(t, msg.Answer[0], clone.Answer[0])
+	assert.Equal(t, msg.Answer[0], clone.Answer[0])
+}
+
+func TestCloner_Clone(t *testing.T) {
+	c := dnsmsg.NewCloner()
+	msg := newBenchMsg()
+
+	clone := c.Clone(msg)
+	defer c.Dispose(clone)
+
+	require.Len(t, clone.Answer, len(msg.Answer))
+	for i, rr := range msg.Answer {
+		assert.NotSame(t, rr, clone.Answer[i])
+		assert.Equal(t, rr, clone.Answer[i])
+	}
+
+	require.Len(t, clone.Ns, len(msg.Ns))
+	assert.Equal(t, msg.Ns[0], clone.Ns[0])
+
+	require.Len(t, clone.Extra, len(msg.Extra))
+	assert.Equal(t, msg.Extra[0], clone.Extra[0])
+
+	// Mutating the clone must not affect the original.
+	clone.Answer[0].(*dns.A).A[0] = 9
+	assert.NotEqual(t, msg.Answer[0].(*dns.A).A[0], clone.Answer[0].(*dns.A).A[0])
+}
@@ -0,0 +1,211 @@
+package dnsserver
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// DNS-over-HTTPS Paths and MIME Types
+
+const (
+	// PathDoH is the default path for the DNS-over-HTTPS wire-format
+	// endpoint.
+	PathDoH = "/dns-query"
+
+	// PathJSON is the default path for the DNS-over-HTTPS JSON endpoint,
+	// compatible with Google's and Cloudflare's DoH-JSON APIs.
+	PathJSON = "/resolve"
+)
+
+const (
+	// MimeTypeDoH is the MIME type used for DNS-over-HTTPS requests and
+	// responses in wire format.
+	MimeTypeDoH = "application/dns-message"
+
+	// MimeTypeJSON is the MIME type used for DNS-over-HTTPS requests and
+	// responses in JSON format.
+	MimeTypeJSON = "application/dns-json"
+)
+
+// JSON Message Types
+
+// JSONMsg is the JSON representation of a DNS message, compatible with
+// Google's and Cloudflare's DoH-JSON APIs.
+type JSONMsg struct {
+	Status             int            `json:"Status"`
+	Truncated          bool           `json:"TC"`
+	RecursionDesired   bool           `json:"RD"`
+	RecursionAvailable bool           `json:"RA"`
+	AuthenticatedData  bool           `json:"AD"`
+	CheckingDisabled   bool           `json:"CD"`
+	Question           []JSONQuestion `json:"Question"`
+	Answer             []JSONAnswer   `json:"Answer,omitempty"`
+	Extra              []JSONAnswer   `json:"Extra,omitempty"`
+}
+
+// JSONQuestion is the JSON representation of a DNS question.
+type JSONQuestion struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+}
+
+// JSONAnswer is the JSON representation of a DNS resource record.  Data is
+// always set to the record's rdata in presentation format, for clients that
+// only care about the text representation.  The remaining fields are set
+// for record types whose rdata has a well-known structure, letting clients
+// avoid parsing Data themselves.
+type JSONAnswer struct {
+	// Name is the owner name of the record.
+	Name string `json:"name"`
+
+	// Type is the record's numeric type, see [dns.TypeToString].
+	Type uint16 `json:"type"`
+
+	// Class is the record's class, e.g. [dns.ClassINET].
+	Class uint16 `json:"class,omitempty"`
+
+	// TTL is the record's time-to-live, in seconds.
+	TTL uint32 `json:"TTL"`
+
+	// Data is the record's rdata in presentation format.
+	Data string `json:"data"`
+
+	// Priority is set for MX, SRV, and SVCB/HTTPS records.
+	Priority *uint16 `json:"priority,omitempty"`
+
+	// Weight is set for SRV records.
+	Weight *uint16 `json:"weight,omitempty"`
+
+	// Port is set for SRV records.
+	Port *uint16 `json:"port,omitempty"`
+
+	// Target is set for records that point to another name or carry an
+	// opaque payload best left out of Params, e.g. MX, SRV, SVCB/HTTPS, CAA,
+	// DS, DNSKEY, and TLSA.
+	Target string `json:"target,omitempty"`
+
+	// Params contains the remaining type-specific fields, such as the
+	// SvcParams of an SVCB/HTTPS record or the tag/flag of a CAA record.
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// DNSMsgToJSONMsg converts m to its JSON representation.
+func DNSMsgToJSONMsg(m *dns.Msg) (jsonMsg *JSONMsg) {
+	jsonMsg = &JSONMsg{
+		Status:             m.Rcode,
+		Truncated:          m.Truncated,
+		RecursionDesired:   m.RecursionDesired,
+		RecursionAvailable: m.RecursionAvailable,
+		AuthenticatedData:  m.AuthenticatedData,
+		CheckingDisabled:   m.CheckingDisabled,
+	}
+
+	for _, q := range m.Question {
+		jsonMsg.Question = append(jsonMsg.Question, JSONQuestion{
+			Name: q.Name,
+			Type: q.Qtype,
+		})
+	}
+
+	for _, rr := range m.Answer {
+		jsonMsg.Answer = append(jsonMsg.Answer, rrToJSONAnswer(rr))
+	}
+
+	for _, rr := range m.Extra {
+		jsonMsg.Extra = append(jsonMsg.Extra, rrToJSONAnswer(rr))
+	}
+
+	return jsonMsg
+}
+
+// rrToJSONAnswer converts rr to its JSON representation, adding structured
+// fields for the record types that have them.
+func rrToJSONAnswer(rr dns.RR) (ja JSONAnswer) {
+	hdr := rr.Header()
+	ja = JSONAnswer{
+		Name:  hdr.Name,
+		Type:  hdr.Rrtype,
+		Class: hdr.Class,
+		TTL:   hdr.Ttl,
+		Data:  rrData(rr),
+	}
+
+	switch v := rr.(type) {
+	case *dns.MX:
+		ja.Priority = uint16Ptr(v.Preference)
+		ja.Target = v.Mx
+	case *dns.SRV:
+		ja.Priority = uint16Ptr(v.Priority)
+		ja.Weight = uint16Ptr(v.Weight)
+		ja.Port = uint16Ptr(v.Port)
+		ja.Target = v.Target
+	case *dns.SVCB:
+		ja.Priority = uint16Ptr(v.Priority)
+		ja.Target = v.Target
+		ja.Params = svcbParams(v.Value)
+	case *dns.HTTPS:
+		// dns.HTTPS is a distinct Go type, struct{ SVCB }, not *dns.SVCB
+		// itself, even though it shares the SVCB wire format.
+		ja.Priority = uint16Ptr(v.Priority)
+		ja.Target = v.Target
+		ja.Params = svcbParams(v.Value)
+	case *dns.CAA:
+		ja.Target = v.Value
+		ja.Params = map[string]string{
+			"flag": strconv.Itoa(int(v.Flag)),
+			"tag":  v.Tag,
+		}
+	case *dns.DS:
+		ja.Target = v.Digest
+		ja.Params = map[string]string{
+			"keytag":     strconv.Itoa(int(v.KeyTag)),
+			"algorithm":  strconv.Itoa(int(v.Algorithm)),
+			"digesttype": strconv.Itoa(int(v.DigestType)),
+		}
+	case *dns.DNSKEY:
+		ja.Target = v.PublicKey
+		ja.Params = map[string]string{
+			"flags":     strconv.Itoa(int(v.Flags)),
+			"protocol":  strconv.Itoa(int(v.Protocol)),
+			"algorithm": strconv.Itoa(int(v.Algorithm)),
+		}
+	case *dns.TLSA:
+		ja.Target = v.Certificate
+		ja.Params = map[string]string{
+			"usage":        strconv.Itoa(int(v.Usage)),
+			"selector":     strconv.Itoa(int(v.Selector)),
+			"matchingtype": strconv.Itoa(int(v.MatchingType)),
+		}
+	}
+
+	return ja
+}
+
+// rrData returns the rdata portion of rr in presentation format, i.e. rr's
+// full text representation with the leading owner/TTL/class/type header
+// stripped.
+func rrData(rr dns.RR) (data string) {
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
+
+// svcbParams converts the key-value pairs of an SVCB/HTTPS record to a
+// string map, using the same presentation format as [dns.SVCB.String].
+func svcbParams(kvs []dns.SVCBKeyValue) (params map[string]string) {
+	if len(kvs) == 0 {
+		return nil
+	}
+
+	params = make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		params[kv.Key().String()] = kv.String()
+	}
+
+	return params
+}
+
+// uint16Ptr returns a pointer to a copy of v.
+func uint16Ptr(v uint16) (p *uint16) {
+	return &v
+}
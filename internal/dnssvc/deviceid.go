@@ -0,0 +1,136 @@
+package dnssvc
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/agd"
+	"github.com/AdguardTeam/AdGuardDNS/internal/dnsserver"
+)
+
+// Device ID Detection
+
+// deviceIDFromContext extracts the device ID from the information attached
+// to ctx, if any, for the given protocol.  wildcards are the server-name
+// wildcards used to detect device IDs for DoT and DoQ, as well as for the
+// domain-name fallback for DoH; see deviceIDFromServerName.  certTrust, if
+// not nil, enables the mTLS client-certificate extraction mode for DoT, DoQ,
+// and DoH: when the client has presented a certificate chaining to
+// certTrust, its Subject CN is used as the device ID, taking precedence over
+// any SNI- or path-derived ID (see deviceIDFromClientCert).
+func deviceIDFromContext(
+	ctx context.Context,
+	proto agd.Protocol,
+	wildcards []string,
+	certTrust *x509.CertPool,
+) (id agd.DeviceID, err error) {
+	if proto == agd.ProtoDNSUDP {
+		return "", nil
+	}
+
+	ci, _ := dnsserver.ClientInfoFromContext(ctx)
+
+	if certTrust != nil && ci.TLS != nil && len(ci.TLS.PeerCertificates) > 0 {
+		id, err = deviceIDFromClientCert(ci.TLS.PeerCertificates, certTrust)
+		if err != nil {
+			return "", fmt.Errorf("client certificate device id check: %w", err)
+		} else if id != "" {
+			return id, nil
+		}
+	}
+
+	if proto == agd.ProtoDoH && ci.URL != nil {
+		id, err = deviceIDFromHTTPPath(ci.URL.Path)
+		if err != nil {
+			return "", fmt.Errorf("http url device id check: %w", err)
+		} else if id != "" {
+			return id, nil
+		}
+	}
+
+	id, err = deviceIDFromServerName(ci.TLSServerName, wildcards)
+	if err != nil {
+		return "", fmt.Errorf("tls server name device id check: %w", err)
+	}
+
+	return id, nil
+}
+
+// deviceIDFromServerName extracts the device ID from a TLS server name, also
+// known as SNI, given the wildcard domains used for the server group.  If
+// sni doesn't match any of wildcards, or if the matched label is empty or
+// contains further subdomains, deviceIDFromServerName returns an empty
+// device ID and a nil error, since that simply means that the server name
+// wasn't meant to carry a device ID.
+func deviceIDFromServerName(sni string, wildcards []string) (id agd.DeviceID, err error) {
+	if sni == "" {
+		return "", nil
+	}
+
+	for _, w := range wildcards {
+		suffix := strings.TrimPrefix(w, "*")
+		if !strings.HasSuffix(sni, suffix) {
+			continue
+		}
+
+		label := strings.TrimSuffix(sni, suffix)
+		if label == "" || strings.Contains(label, ".") {
+			continue
+		}
+
+		return agd.NewDeviceID(label)
+	}
+
+	return "", nil
+}
+
+// deviceIDFromHTTPPath extracts the device ID from the path of a DoH
+// request.  The path must either be exactly [dnsserver.PathDoH] (in which
+// case there is no device ID) or [dnsserver.PathDoH] followed by exactly one
+// more path segment containing the device ID.
+func deviceIDFromHTTPPath(urlPath string) (id agd.DeviceID, err error) {
+	withoutSlash := strings.TrimSuffix(urlPath, "/")
+	if withoutSlash == dnsserver.PathDoH {
+		return "", nil
+	}
+
+	prefix := dnsserver.PathDoH + "/"
+	if !strings.HasPrefix(withoutSlash, prefix) {
+		return "", fmt.Errorf("bad path %q", urlPath)
+	}
+
+	rest := strings.TrimPrefix(withoutSlash, prefix)
+	if strings.Contains(rest, "/") {
+		return "", fmt.Errorf("bad path %q: extra parts", urlPath)
+	}
+
+	return agd.NewDeviceID(rest)
+}
+
+// deviceIDFromClientCert extracts the device ID from the leaf client
+// certificate in certs, after verifying that it chains up to trust.  The
+// device ID is taken from the certificate's Subject Common Name.
+func deviceIDFromClientCert(
+	certs []*x509.Certificate,
+	trust *x509.CertPool,
+) (id agd.DeviceID, err error) {
+	leaf := certs[0]
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         trust,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return "", fmt.Errorf("verifying client certificate: %w", err)
+	}
+
+	return agd.NewDeviceID(leaf.Subject.CommonName)
+}
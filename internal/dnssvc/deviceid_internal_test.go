@@ -2,8 +2,15 @@ package dnssvc
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/AdguardTeam/AdGuardDNS/internal/agd"
 	"github.com/AdguardTeam/AdGuardDNS/internal/dnsserver"
@@ -107,13 +114,155 @@ func TestService_Wrap_deviceID(t *testing.T) {
 				TLSServerName: tc.cliSrvName,
 			})
 
-			deviceID, err := deviceIDFromContext(ctx, tc.proto, tc.wildcards)
+			deviceID, err := deviceIDFromContext(ctx, tc.proto, tc.wildcards, nil)
 			assert.Equal(t, tc.wantDeviceID, deviceID)
 			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
 		})
 	}
 }
 
+// newTestCA returns a new self-signed CA certificate with the given common
+// name and its key, for use in client-certificate device ID tests.
+func newTestCA(t *testing.T, cn string) (cert *x509.Certificate, key *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Unix(0, 0),
+		NotAfter:              time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert, key
+}
+
+// newTestClientCert returns a new client certificate with the given common
+// name, signed by ca/caKey.
+func newTestClientCert(
+	t *testing.T,
+	cn string,
+	ca *x509.Certificate,
+	caKey *rsa.PrivateKey,
+) (cert *x509.Certificate) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+
+	cert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert
+}
+
+func TestService_Wrap_deviceIDClientCert(t *testing.T) {
+	ca, caKey := newTestCA(t, "Test CA")
+
+	trust := x509.NewCertPool()
+	trust.AddCert(ca)
+
+	otherCA, otherCAKey := newTestCA(t, "Other Test CA")
+
+	goodCert := newTestClientCert(t, "dev", ca, caKey)
+	unknownCert := newTestClientCert(t, "dev", otherCA, otherCAKey)
+
+	t.Run("no_client_cert", func(t *testing.T) {
+		ctx := context.Background()
+		ctx = dnsserver.ContextWithClientInfo(ctx, dnsserver.ClientInfo{
+			TLSServerName: "dev.dns.example.com",
+		})
+
+		deviceID, err := deviceIDFromContext(
+			ctx,
+			agd.ProtoDoT,
+			[]string{"*.dns.example.com"},
+			trust,
+		)
+		require.NoError(t, err)
+
+		assert.Equal(t, agd.DeviceID("dev"), deviceID)
+	})
+
+	t.Run("unknown_ca", func(t *testing.T) {
+		ctx := context.Background()
+		ctx = dnsserver.ContextWithClientInfo(ctx, dnsserver.ClientInfo{
+			TLS: &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{unknownCert},
+			},
+		})
+
+		deviceID, err := deviceIDFromContext(ctx, agd.ProtoDoT, nil, trust)
+		assert.Empty(t, deviceID)
+		testutil.AssertErrorMsg(
+			t,
+			"client certificate device id check: verifying client certificate: "+
+				"x509: certificate signed by unknown authority",
+			err,
+		)
+	})
+
+	t.Run("valid_cert", func(t *testing.T) {
+		ctx := context.Background()
+		ctx = dnsserver.ContextWithClientInfo(ctx, dnsserver.ClientInfo{
+			TLS: &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{goodCert},
+			},
+		})
+
+		deviceID, err := deviceIDFromContext(ctx, agd.ProtoDoT, nil, trust)
+		require.NoError(t, err)
+
+		assert.Equal(t, agd.DeviceID("dev"), deviceID)
+	})
+
+	t.Run("cert_clashes_with_sni", func(t *testing.T) {
+		// The client certificate's CN takes precedence over the SNI-derived
+		// device ID, so "dev" (from the certificate) wins over "other" (from
+		// the server name).
+		ctx := context.Background()
+		ctx = dnsserver.ContextWithClientInfo(ctx, dnsserver.ClientInfo{
+			TLSServerName: "other.dns.example.com",
+			TLS: &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{goodCert},
+			},
+		})
+
+		deviceID, err := deviceIDFromContext(
+			ctx,
+			agd.ProtoDoT,
+			[]string{"*.dns.example.com"},
+			trust,
+		)
+		require.NoError(t, err)
+
+		assert.Equal(t, agd.DeviceID("dev"), deviceID)
+	})
+}
+
 func TestService_Wrap_deviceIDHTTPS(t *testing.T) {
 	testCases := []struct {
 		name         string
@@ -174,7 +323,7 @@ func TestService_Wrap_deviceIDHTTPS(t *testing.T) {
 				URL: u,
 			})
 
-			deviceID, err := deviceIDFromContext(ctx, proto, nil)
+			deviceID, err := deviceIDFromContext(ctx, proto, nil, nil)
 			assert.Equal(t, tc.wantDeviceID, deviceID)
 			testutil.AssertErrorMsg(t, tc.wantErrMsg, err)
 		})
@@ -198,7 +347,7 @@ func TestService_Wrap_deviceIDHTTPS(t *testing.T) {
 			Proto: proto,
 		})
 
-		deviceID, err := deviceIDFromContext(ctx, proto, []string{"*.dns.example.com"})
+		deviceID, err := deviceIDFromContext(ctx, proto, []string{"*.dns.example.com"}, nil)
 		require.NoError(t, err)
 
 		assert.Equal(t, agd.DeviceID(want), deviceID)
@@ -0,0 +1,139 @@
+package errcoll
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/agd"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// FileConfig is the configuration for [File].
+type FileConfig struct {
+	// Path is the path to the file to write errors to.
+	Path string
+
+	// MaxSizeBytes is the approximate size, in bytes, at which the file is
+	// rotated.  If it is zero or negative, the file is never rotated.
+	MaxSizeBytes int64
+
+	// MaxBackups is the number of rotated files to keep alongside the
+	// current one.  Older files beyond this count are removed.  If it is zero
+	// or negative, rotated files are never removed.
+	MaxBackups int
+}
+
+// File is an [agd.ErrorCollector] that writes errors to a local file,
+// rotating it once it grows past a configured size.
+type File struct {
+	mu *sync.Mutex
+	f  *os.File
+	n  int64
+	c  *FileConfig
+}
+
+// NewFile returns a new *File using the given configuration.  c must not be
+// nil.
+func NewFile(c *FileConfig) (f *File, err error) {
+	file, n, err := openFileForAppend(c.Path)
+	if err != nil {
+		return nil, fmt.Errorf("opening error log file: %w", err)
+	}
+
+	return &File{
+		mu: &sync.Mutex{},
+		f:  file,
+		n:  n,
+		c:  c,
+	}, nil
+}
+
+// openFileForAppend opens path for appending, creating it if necessary, and
+// returns the file along with its current size.
+func openFileForAppend(path string) (f *os.File, size int64, err error) {
+	f, err = os.OpenFile(path, agd.DefaultWOFlags, agd.DefaultPerm)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return f, fi.Size(), nil
+}
+
+// type check
+var _ agd.ErrorCollector = (*File)(nil)
+
+// Collect implements the [agd.ErrorCollector] interface for *File.
+func (f *File) Collect(_ context.Context, err error) {
+	line := []byte(fmt.Sprintf("%s error: %s\n", time.Now().Format(time.RFC3339), err))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.c.MaxSizeBytes > 0 && f.n+int64(len(line)) > f.c.MaxSizeBytes {
+		f.rotate()
+	}
+
+	n, wErr := f.f.Write(line)
+	if wErr != nil {
+		log.Error("errcoll: file: writing: %s", wErr)
+
+		return
+	}
+
+	f.n += int64(n)
+}
+
+// rotate closes the current file, renames it with a timestamp suffix, prunes
+// old backups beyond c.MaxBackups, and opens a fresh file at the original
+// path.  f.mu must be held.
+func (f *File) rotate() {
+	path := f.c.Path
+
+	if cErr := f.f.Close(); cErr != nil {
+		log.Error("errcoll: file: closing for rotation: %s", cErr)
+	}
+
+	rotated := fmt.Sprintf("%s.%s", path, time.Now().Format("20060102T150405"))
+	if rErr := os.Rename(path, rotated); rErr != nil {
+		log.Error("errcoll: file: renaming for rotation: %s", rErr)
+	}
+
+	pruneBackups(path, f.c.MaxBackups)
+
+	newF, n, oErr := openFileForAppend(path)
+	if oErr != nil {
+		log.Error("errcoll: file: reopening after rotation: %s", oErr)
+
+		return
+	}
+
+	f.f, f.n = newF, n
+}
+
+// pruneBackups removes the oldest rotated files for path beyond the most
+// recent keep of them.
+func pruneBackups(path string, keep int) {
+	if keep <= 0 {
+		return
+	}
+
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil || len(matches) <= keep {
+		return
+	}
+
+	// Rotated file names include a lexicographically sortable timestamp
+	// suffix, so the oldest files are simply the first ones in sorted order.
+	for _, old := range matches[:len(matches)-keep] {
+		_ = os.Remove(old)
+	}
+}
@@ -0,0 +1,43 @@
+package errcoll
+
+import (
+	"context"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/agd"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Multi is an [agd.ErrorCollector] that fans out every error to several
+// collectors.  It is mainly useful for combining the default stderr
+// collector with one or more remote backends.
+type Multi struct {
+	colls []agd.ErrorCollector
+}
+
+// NewMulti returns a new *Multi that reports every error to each of colls.
+func NewMulti(colls ...agd.ErrorCollector) (m *Multi) {
+	return &Multi{
+		colls: colls,
+	}
+}
+
+// type check
+var _ agd.ErrorCollector = (*Multi)(nil)
+
+// Collect implements the [agd.ErrorCollector] interface for *Multi.  It
+// reports err to every collector in m, regardless of whether the others
+// panic or not.
+func (m *Multi) Collect(ctx context.Context, err error) {
+	for _, c := range m.colls {
+		collectRecovering(ctx, c, err)
+	}
+}
+
+// collectRecovering calls c.Collect(ctx, err), recovering and logging any
+// panic so that a single misbehaving collector can't stop the rest of
+// [Multi.Collect] from running.
+func collectRecovering(ctx context.Context, c agd.ErrorCollector, err error) {
+	defer log.OnPanic("errcoll: multi: collect")
+
+	c.Collect(ctx, err)
+}
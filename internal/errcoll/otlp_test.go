@@ -0,0 +1,54 @@
+package errcoll_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/errcoll"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewOTLP_badTransport makes sure that an unsupported transport value is
+// rejected instead of silently being treated as the HTTP one.
+func TestNewOTLP_badTransport(t *testing.T) {
+	_, err := errcoll.NewOTLP(&errcoll.OTLPConfig{
+		Endpoint:  "http://otel.example.com",
+		Transport: "carrier-pigeon",
+		Timeout:   1 * time.Second,
+	})
+	assert.Error(t, err)
+}
+
+// TestOTLP_Collect makes sure that Collect sends the collected error as an
+// OTLP/HTTP JSON log record to the configured endpoint's "/v1/logs" path.
+func TestOTLP_Collect(t *testing.T) {
+	reqCh := make(chan *http.Request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqCh <- r
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	o, err := errcoll.NewOTLP(&errcoll.OTLPConfig{
+		Endpoint:  srv.URL,
+		Transport: errcoll.OTLPTransportHTTP,
+		Timeout:   1 * time.Second,
+	})
+	require.NoError(t, err)
+
+	o.Collect(context.Background(), errors.New("test error"))
+
+	select {
+	case r := <-reqCh:
+		assert.Equal(t, "/v1/logs", r.URL.Path)
+		assert.Equal(t, http.MethodPost, r.Method)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the otlp request")
+	}
+}
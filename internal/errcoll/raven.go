@@ -0,0 +1,31 @@
+package errcoll
+
+import (
+	"context"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/agd"
+	"github.com/getsentry/raven-go"
+)
+
+// RavenErrorCollector is an [agd.ErrorCollector] that reports errors to a
+// Sentry-compatible backend using a [*raven.Client].
+type RavenErrorCollector struct {
+	client *raven.Client
+}
+
+// NewRavenErrorCollector returns a new *RavenErrorCollector that uses client
+// to report errors.
+func NewRavenErrorCollector(client *raven.Client) (r *RavenErrorCollector) {
+	return &RavenErrorCollector{
+		client: client,
+	}
+}
+
+// type check
+var _ agd.ErrorCollector = (*RavenErrorCollector)(nil)
+
+// Collect implements the [agd.ErrorCollector] interface for
+// *RavenErrorCollector.
+func (r *RavenErrorCollector) Collect(_ context.Context, err error) {
+	r.client.CaptureError(err, nil)
+}
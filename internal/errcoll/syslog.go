@@ -0,0 +1,61 @@
+//go:build !windows
+
+package errcoll
+
+import (
+	"context"
+	"fmt"
+	"log/syslog"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/agd"
+)
+
+// SyslogConfig is the configuration for [Syslog].
+type SyslogConfig struct {
+	// Network is the network to use to reach the syslog daemon, e.g. "tcp"
+	// or "udp".  If empty, the local syslog daemon is used.
+	Network string
+
+	// Addr is the address of the syslog daemon.  It is only used if Network
+	// is not empty.
+	Addr string
+
+	// Tag is the tag to prefix every message with.
+	Tag string
+
+	// Facility is the syslog facility to report errors under, e.g.
+	// [syslog.LOG_DAEMON] or [syslog.LOG_LOCAL0].  If zero, [syslog.LOG_DAEMON]
+	// is used.
+	Facility syslog.Priority
+}
+
+// Syslog is an [agd.ErrorCollector] that reports errors to a syslog daemon.
+type Syslog struct {
+	w *syslog.Writer
+}
+
+// NewSyslog returns a new *Syslog using the given configuration.  c must not
+// be nil.
+func NewSyslog(c *SyslogConfig) (s *Syslog, err error) {
+	facility := c.Facility
+	if facility == 0 {
+		facility = syslog.LOG_DAEMON
+	}
+
+	w, err := syslog.Dial(c.Network, c.Addr, syslog.LOG_ERR|facility, c.Tag)
+	if err != nil {
+		return nil, fmt.Errorf("dialing syslog: %w", err)
+	}
+
+	return &Syslog{
+		w: w,
+	}, nil
+}
+
+// type check
+var _ agd.ErrorCollector = (*Syslog)(nil)
+
+// Collect implements the [agd.ErrorCollector] interface for *Syslog.
+func (s *Syslog) Collect(_ context.Context, err error) {
+	_ = s.w.Err(err.Error())
+}
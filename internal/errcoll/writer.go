@@ -0,0 +1,42 @@
+// Package errcoll contains implementations of the [agd.ErrorCollector]
+// interface.
+package errcoll
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/agd"
+)
+
+// WriterErrorCollector is an [agd.ErrorCollector] that writes errors to an
+// [io.Writer], one per line.  It is mainly useful for local development and
+// as the default, stderr-based collector.
+type WriterErrorCollector struct {
+	mu  *sync.Mutex
+	out io.Writer
+}
+
+// NewWriterErrorCollector returns a new *WriterErrorCollector that writes to
+// out.  out must be safe for concurrent use, or w must be the only writer
+// using it.
+func NewWriterErrorCollector(out io.Writer) (w *WriterErrorCollector) {
+	return &WriterErrorCollector{
+		mu:  &sync.Mutex{},
+		out: out,
+	}
+}
+
+// type check
+var _ agd.ErrorCollector = (*WriterErrorCollector)(nil)
+
+// Collect implements the [agd.ErrorCollector] interface for
+// *WriterErrorCollector.
+func (w *WriterErrorCollector) Collect(_ context.Context, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, _ = fmt.Fprintf(w.out, "error: %s\n", err)
+}
@@ -0,0 +1,334 @@
+package filter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/agd"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// Hosts-File Filter
+
+// HostsFileConfig is the configuration for a single hosts-format source used
+// by [HostsContainer].
+type HostsFileConfig struct {
+	// Source is either a local file path or an "http://"/"https://" URL
+	// pointing to a BSD "/etc/hosts"-syntax file.
+	Source string
+
+	// RefreshIvl is the interval between refreshes of this source.
+	RefreshIvl time.Duration
+
+	// Priority determines which source wins when the same name or address is
+	// defined in more than one hosts file; higher values win.
+	Priority int
+}
+
+// hostsRecord is a single, fully parsed entry from a hosts-format file.
+type hostsRecord struct {
+	addr  netip.Addr
+	names []string
+	ttl   time.Duration
+}
+
+// HostsContainer is a filter that ingests one or more hosts-format files and
+// synthesizes A/AAAA/PTR answers directly, short-circuiting the rule engine
+// and upstream resolution.
+type HostsContainer struct {
+	httpClient *http.Client
+
+	mu *sync.RWMutex
+
+	// byName maps a lowercased, FQDN host name to the records that currently
+	// win for it, one per address family (see [HostsFileConfig.Priority]).
+	byName map[string]*hostsNameEntry
+
+	// byAddr maps an address to the names that currently win for it.
+	byAddr map[netip.Addr]*hostsRecordWithPriority
+
+	sources []*hostsSource
+
+	// now returns the current time; used to honor each source's
+	// [HostsFileConfig.RefreshIvl].
+	now func() (t time.Time)
+}
+
+// hostsRecordWithPriority pairs a record with the priority of the source it
+// came from, so that later refreshes from a higher-priority source can
+// override it.
+type hostsRecordWithPriority struct {
+	rec      *hostsRecord
+	priority int
+}
+
+// hostsNameEntry holds the winning record for a single host name, per address
+// family, so that an A and an AAAA entry for the same name don't compete for
+// the same slot and silently drop one another.
+type hostsNameEntry struct {
+	v4 *hostsRecordWithPriority
+	v6 *hostsRecordWithPriority
+}
+
+// hostsSource is the refresh state for a single configured hosts file.
+type hostsSource struct {
+	conf *HostsFileConfig
+
+	// cachedRecs are the records from the last successful read of this
+	// source, reused as long as nextRefresh hasn't arrived yet.
+	cachedRecs []*hostsRecord
+
+	// nextRefresh is the earliest time at which this source should be
+	// re-read.  The zero value means the source has never been read yet, and
+	// so it is always due.
+	nextRefresh time.Time
+}
+
+// NewHostsContainer returns a new *HostsContainer for the given sources.  It
+// performs no I/O; call Refresh to populate it.  now is used to determine
+// when a source is due for a re-read based on its own
+// [HostsFileConfig.RefreshIvl]; if nil, [time.Now] is used.
+func NewHostsContainer(now func() (t time.Time), confs ...*HostsFileConfig) (c *HostsContainer) {
+	if now == nil {
+		now = time.Now
+	}
+
+	sources := make([]*hostsSource, len(confs))
+	for i, hc := range confs {
+		sources[i] = &hostsSource{conf: hc}
+	}
+
+	return &HostsContainer{
+		httpClient: http.DefaultClient,
+		mu:         &sync.RWMutex{},
+		byName:     map[string]*hostsNameEntry{},
+		byAddr:     map[netip.Addr]*hostsRecordWithPriority{},
+		sources:    sources,
+		now:        now,
+	}
+}
+
+// type check
+var _ agd.Refresher = (*HostsContainer)(nil)
+
+// Refresh implements the [agd.Refresher] interface for *HostsContainer.  It
+// re-reads every source that is due for a refresh, according to its own
+// [HostsFileConfig.RefreshIvl], and atomically swaps in the merged result of
+// all sources, including those not due and so served from their last
+// successful read.
+func (c *HostsContainer) Refresh(ctx context.Context) (err error) {
+	byName := map[string]*hostsNameEntry{}
+	byAddr := map[netip.Addr]*hostsRecordWithPriority{}
+
+	now := c.now()
+
+	var errs []error
+	for _, src := range c.sources {
+		recs := src.cachedRecs
+		if src.nextRefresh.IsZero() || !now.Before(src.nextRefresh) {
+			var rErr error
+			recs, rErr = c.readSource(ctx, src.conf.Source)
+			if rErr != nil {
+				errs = append(errs, fmt.Errorf("hosts file %q: %w", src.conf.Source, rErr))
+
+				continue
+			}
+
+			src.cachedRecs = recs
+			if src.conf.RefreshIvl > 0 {
+				src.nextRefresh = now.Add(src.conf.RefreshIvl)
+			}
+		}
+
+		for _, rec := range recs {
+			cur, ok := byAddr[rec.addr]
+			if !ok || cur.priority <= src.conf.Priority {
+				byAddr[rec.addr] = &hostsRecordWithPriority{rec: rec, priority: src.conf.Priority}
+			}
+
+			for _, name := range rec.names {
+				entry, ok := byName[name]
+				if !ok {
+					entry = &hostsNameEntry{}
+					byName[name] = entry
+				}
+
+				slot := &entry.v4
+				if rec.addr.Is6() {
+					slot = &entry.v6
+				}
+
+				if *slot == nil || (*slot).priority <= src.conf.Priority {
+					*slot = &hostsRecordWithPriority{rec: rec, priority: src.conf.Priority}
+				}
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.byName = byName
+	c.byAddr = byAddr
+	c.mu.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// readSource reads and parses a single hosts-format source, which may be a
+// local file path or an HTTP(S) URL.
+func (c *HostsContainer) readSource(ctx context.Context, src string) (recs []*hostsRecord, err error) {
+	var r io.ReadCloser
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating request: %w", err)
+		}
+
+		var resp *http.Response
+		resp, err = c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("requesting: %w", err)
+		}
+
+		if resp.StatusCode/100 != 2 {
+			_ = resp.Body.Close()
+
+			return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+
+		r = resp.Body
+	} else {
+		r, err = os.Open(src)
+		if err != nil {
+			return nil, fmt.Errorf("opening file: %w", err)
+		}
+	}
+	defer func() { err = errors.WithDeferred(err, r.Close()) }()
+
+	return parseHosts(r)
+}
+
+// defaultHostsTTL is used for hosts entries that don't have an explicit TTL
+// directive.
+const defaultHostsTTL = 1 * time.Hour
+
+// parseHosts parses BSD "/etc/hosts"-syntax data from r.  Each non-empty,
+// non-comment line must start with an IPv4 or IPv6 address followed by one
+// or more whitespace-separated host names.  A trailing comment of the form
+// "# ttl=<seconds>" sets the TTL for that line's entry; otherwise
+// [defaultHostsTTL] is used.
+func parseHosts(r io.Reader) (recs []*hostsRecord, err error) {
+	s := bufio.NewScanner(r)
+	for lineNo := 1; s.Scan(); lineNo++ {
+		line := strings.TrimSpace(s.Text())
+		ttl := defaultHostsTTL
+
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			if d, ok := parseTTLComment(line[i+1:]); ok {
+				ttl = d
+			}
+
+			line = strings.TrimSpace(line[:i])
+		}
+
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected an address and at least one name", lineNo)
+		}
+
+		addr, pErr := netip.ParseAddr(fields[0])
+		if pErr != nil {
+			return nil, fmt.Errorf("line %d: bad address %q: %w", lineNo, fields[0], pErr)
+		}
+
+		names := make([]string, len(fields)-1)
+		for i, n := range fields[1:] {
+			names[i] = dnsFQDN(strings.ToLower(n))
+		}
+
+		recs = append(recs, &hostsRecord{addr: addr, names: names, ttl: ttl})
+	}
+
+	if sErr := s.Err(); sErr != nil {
+		return nil, fmt.Errorf("scanning: %w", sErr)
+	}
+
+	return recs, nil
+}
+
+// parseTTLComment parses the "ttl=<seconds>" directive, a positive integer
+// number of seconds, from a hosts-file comment, if present.
+func parseTTLComment(comment string) (d time.Duration, ok bool) {
+	comment = strings.TrimSpace(comment)
+	const prefix = "ttl="
+	if !strings.HasPrefix(comment, prefix) {
+		return 0, false
+	}
+
+	secs, err := strconv.Atoi(strings.TrimPrefix(comment, prefix))
+	if err != nil || secs <= 0 {
+		return 0, false
+	}
+
+	return time.Duration(secs) * time.Second, true
+}
+
+// dnsFQDN appends a trailing dot to name if it does not already have one.
+func dnsFQDN(name string) (fqdn string) {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+
+	return name + "."
+}
+
+// MatchHost returns the address and TTL synthesized for the given FQDN host
+// name, if any hosts file defines one.  v6 selects between the name's AAAA
+// and A entry, since a hosts file may define both for the same name.
+func (c *HostsContainer) MatchHost(host string, v6 bool) (addr netip.Addr, ttl time.Duration, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.byName[dnsFQDN(strings.ToLower(host))]
+	if !ok {
+		return netip.Addr{}, 0, false
+	}
+
+	rp := entry.v4
+	if v6 {
+		rp = entry.v6
+	}
+
+	if rp == nil {
+		return netip.Addr{}, 0, false
+	}
+
+	return rp.rec.addr, rp.rec.ttl, true
+}
+
+// MatchAddr returns the host names synthesized for the given address for a
+// reverse (PTR) lookup, if any hosts file defines one.
+func (c *HostsContainer) MatchAddr(addr netip.Addr) (names []string, ttl time.Duration, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rp, ok := c.byAddr[addr]
+	if !ok {
+		return nil, 0, false
+	}
+
+	return rp.rec.names, rp.rec.ttl, true
+}
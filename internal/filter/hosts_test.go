@@ -0,0 +1,86 @@
+package filter_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/filter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeHostsFile writes contents to a new hosts file under the test's
+// temporary directory and returns its path.
+func writeHostsFile(t *testing.T, contents string) (path string) {
+	t.Helper()
+
+	path = filepath.Join(t.TempDir(), "hosts")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+
+	return path
+}
+
+// TestHostsContainer_Refresh_refreshIvl makes sure that a source isn't
+// re-read until its own [filter.HostsFileConfig.RefreshIvl] has elapsed,
+// even if Refresh is called again sooner.
+func TestHostsContainer_Refresh_refreshIvl(t *testing.T) {
+	path := writeHostsFile(t, "1.2.3.4 example.com\n")
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() (t time.Time) { return now }
+
+	c := filter.NewHostsContainer(clock, &filter.HostsFileConfig{
+		Source:     path,
+		RefreshIvl: 1 * time.Hour,
+	})
+
+	require.NoError(t, c.Refresh(context.Background()))
+
+	addr, _, ok := c.MatchHost("example.com.", false)
+	require.True(t, ok)
+	assert.Equal(t, "1.2.3.4", addr.String())
+
+	// Rewrite the file with a different address, but advance the clock by
+	// less than RefreshIvl: the source must still be served from cache.
+	require.NoError(t, os.WriteFile(path, []byte("5.6.7.8 example.com\n"), 0o644))
+	now = now.Add(30 * time.Minute)
+
+	require.NoError(t, c.Refresh(context.Background()))
+
+	addr, _, ok = c.MatchHost("example.com.", false)
+	require.True(t, ok)
+	assert.Equal(t, "1.2.3.4", addr.String(), "source must not be re-read before its refresh interval")
+
+	// Advance the clock past RefreshIvl: the source must now be re-read.
+	now = now.Add(31 * time.Minute)
+
+	require.NoError(t, c.Refresh(context.Background()))
+
+	addr, _, ok = c.MatchHost("example.com.", false)
+	require.True(t, ok)
+	assert.Equal(t, "5.6.7.8", addr.String(), "source must be re-read once its refresh interval has elapsed")
+}
+
+// TestHostsContainer_Refresh_dualStack makes sure that an A and an AAAA
+// record for the same host name don't compete for the same slot and
+// silently drop one another.
+func TestHostsContainer_Refresh_dualStack(t *testing.T) {
+	path := writeHostsFile(t, "1.2.3.4 example.com\n::1 example.com\n")
+
+	c := filter.NewHostsContainer(nil, &filter.HostsFileConfig{
+		Source: path,
+	})
+
+	require.NoError(t, c.Refresh(context.Background()))
+
+	addr, _, ok := c.MatchHost("example.com.", false)
+	require.True(t, ok)
+	assert.Equal(t, "1.2.3.4", addr.String())
+
+	addr, _, ok = c.MatchHost("example.com.", true)
+	require.True(t, ok)
+	assert.Equal(t, "::1", addr.String())
+}
@@ -0,0 +1,236 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/agd"
+	"github.com/AdguardTeam/AdGuardDNS/internal/metrics"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// Per-List Refresh Scheduling
+
+// maxBackoff is the maximum backoff duration applied to a single filter list
+// after repeated refresh failures.
+const maxBackoff = 6 * time.Hour
+
+// minBackoff is the initial backoff duration applied after the first refresh
+// failure.
+const minBackoff = 1 * time.Minute
+
+// listRefreshState is the per-list refresh metadata that is persisted in
+// [DefaultStorageConfig.CacheDir] next to the list itself, so that
+// conditional requests and backoff survive restarts.
+type listRefreshState struct {
+	// ETag is the last seen "ETag" response header value, if any.
+	ETag string `json:"etag,omitempty"`
+
+	// LastModified is the last seen "Last-Modified" response header value, if
+	// any.
+	LastModified string `json:"last_modified,omitempty"`
+
+	// NextAttempt is the earliest time at which the next refresh of this list
+	// should be attempted.  It is used both for the initial stagger delay and
+	// for the exponential backoff after failures.
+	NextAttempt time.Time `json:"next_attempt"`
+
+	// Backoff is the current backoff duration that will be doubled (up to
+	// maxBackoff) on the next failure.
+	Backoff time.Duration `json:"backoff"`
+
+	// Consecutive304 is the number of consecutive refreshes that resulted in
+	// a 304 Not Modified response.  It is only persisted; 304 responses are
+	// counted in metrics separately.
+	Consecutive304 int `json:"consecutive_304"`
+}
+
+// metaPath returns the path to the on-disk refresh metadata file for the
+// filter list with the given ID.
+func (s *DefaultStorage) metaPath(id agd.FilterListID) (p string) {
+	return filepath.Join(s.conf.CacheDir, string(id)+".meta.json")
+}
+
+// loadRefreshState returns the persisted refresh state for id, or a zero
+// state if none has been persisted yet or it cannot be read.
+func (s *DefaultStorage) loadRefreshState(id agd.FilterListID) (st *listRefreshState) {
+	st = &listRefreshState{}
+
+	b, err := os.ReadFile(s.metaPath(id))
+	if err != nil {
+		return st
+	}
+
+	err = json.Unmarshal(b, st)
+	if err != nil {
+		log.Debug("filter: storage: list %s: bad refresh metadata: %s", id, err)
+
+		return &listRefreshState{}
+	}
+
+	return st
+}
+
+// saveRefreshState persists st for the filter list with the given ID.
+func (s *DefaultStorage) saveRefreshState(id agd.FilterListID, st *listRefreshState) {
+	b, err := json.Marshal(st)
+	if err != nil {
+		log.Error("filter: storage: list %s: marshaling refresh metadata: %s", id, err)
+
+		return
+	}
+
+	err = os.WriteFile(s.metaPath(id), b, agd.DefaultPerm)
+	if err != nil {
+		log.Error("filter: storage: list %s: writing refresh metadata: %s", id, err)
+	}
+}
+
+// staggerDelay returns a pseudorandom, deterministic-per-list initial delay
+// within [0, RefreshJitter) used to spread the first refresh of each list in
+// the index across the jitter window, avoiding a stampede on the origin.
+func (s *DefaultStorage) staggerDelay(id agd.FilterListID) (d time.Duration) {
+	jitter := s.conf.RefreshJitter
+	if jitter <= 0 {
+		return 0
+	}
+
+	// #nosec G404 -- Scheduling jitter does not need a CSPRNG.
+	r := rand.New(rand.NewSource(int64(stringHash(string(id)))))
+
+	return time.Duration(r.Int63n(int64(jitter)))
+}
+
+// stringHash is a small, stable, non-cryptographic hash function used only to
+// seed the per-list stagger delay.
+func stringHash(s string) (h uint32) {
+	h = 2166136261
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+
+	return h
+}
+
+// RefreshList refreshes a single filter list identified by id from srcURL,
+// honoring any previously seen ETag/Last-Modified, applying exponential
+// backoff with full jitter on failure, and persisting the outcome.  The first
+// refresh of a list is delayed by [DefaultStorage.staggerDelay].  body is nil
+// if the list isn't due for a refresh yet or if it has not changed since the
+// last successful refresh (that is, the origin responded with 304 Not
+// Modified).
+func (s *DefaultStorage) RefreshList(
+	ctx context.Context,
+	id agd.FilterListID,
+	srcURL string,
+) (body []byte, err error) {
+	st := s.loadRefreshState(id)
+
+	now := s.conf.Now()
+	if st.NextAttempt.IsZero() {
+		st.NextAttempt = now.Add(s.staggerDelay(id))
+		s.saveRefreshState(id, st)
+	}
+
+	if now.Before(st.NextAttempt) {
+		return nil, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srcURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("filter: storage: list %s: creating request: %w", id, err)
+	}
+
+	if st.ETag != "" {
+		req.Header.Set("If-None-Match", st.ETag)
+	}
+
+	if st.LastModified != "" {
+		req.Header.Set("If-Modified-Since", st.LastModified)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.recordFailure(id, st, now)
+
+		return nil, fmt.Errorf("filter: storage: list %s: requesting: %w", id, err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	metrics.FilterListRefreshAge.WithLabelValues(string(id)).Set(now.Sub(st.NextAttempt).Seconds())
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		st.Consecutive304++
+		metrics.FilterList304Total.WithLabelValues(string(id)).Inc()
+		s.recordSuccess(id, st, now)
+
+		return nil, nil
+	case resp.StatusCode/100 == 4, resp.StatusCode/100 == 5:
+		s.recordFailure(id, st, now)
+
+		return nil, fmt.Errorf(
+			"filter: storage: list %s: unexpected status code %d",
+			id,
+			resp.StatusCode,
+		)
+	default:
+		// Go on and read the body below.
+	}
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		s.recordFailure(id, st, now)
+
+		return nil, fmt.Errorf("filter: storage: list %s: reading body: %w", id, err)
+	}
+
+	st.ETag = resp.Header.Get("ETag")
+	st.LastModified = resp.Header.Get("Last-Modified")
+	st.Consecutive304 = 0
+	s.recordSuccess(id, st, now)
+
+	return body, nil
+}
+
+// recordSuccess resets the backoff for the list and schedules its next
+// attempt at the regular refresh interval, staggered on first use.
+func (s *DefaultStorage) recordSuccess(id agd.FilterListID, st *listRefreshState, now time.Time) {
+	st.Backoff = 0
+	delay := s.conf.RefreshIvl
+	if st.NextAttempt.IsZero() {
+		delay = s.staggerDelay(id)
+	}
+
+	st.NextAttempt = now.Add(delay)
+	s.saveRefreshState(id, st)
+}
+
+// recordFailure doubles the backoff for the list, up to maxBackoff, applies
+// full jitter, and schedules the next attempt accordingly.
+func (s *DefaultStorage) recordFailure(id agd.FilterListID, st *listRefreshState, now time.Time) {
+	metrics.FilterListRefreshErrorsTotal.WithLabelValues(string(id)).Inc()
+
+	if st.Backoff <= 0 {
+		st.Backoff = minBackoff
+	} else {
+		st.Backoff *= 2
+		if st.Backoff > maxBackoff {
+			st.Backoff = maxBackoff
+		}
+	}
+
+	// #nosec G404 -- Backoff jitter does not need a CSPRNG.
+	jittered := time.Duration(rand.Int63n(int64(st.Backoff)))
+	st.NextAttempt = now.Add(jittered)
+	s.saveRefreshState(id, st)
+}
@@ -0,0 +1,153 @@
+package filter
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/agd"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// Filter Storage
+
+// DefaultStorageConfig is the configuration for the default filter storage,
+// [DefaultStorage].
+type DefaultStorageConfig struct {
+	// FilterIndexURL is the URL of the filter list index.
+	FilterIndexURL *url.URL
+
+	// BlockedServiceIndexURL is the URL of the blocked service index.
+	BlockedServiceIndexURL *url.URL
+
+	// GeneralSafeSearchRulesURL is the URL of the general safe-search rules
+	// list.
+	GeneralSafeSearchRulesURL *url.URL
+
+	// YoutubeSafeSearchRulesURL is the URL of the YouTube safe-search rules
+	// list.
+	YoutubeSafeSearchRulesURL *url.URL
+
+	// Now returns the current time.
+	Now func() (now time.Time)
+
+	// ErrColl is used to report errors during refreshes.
+	ErrColl agd.ErrorCollector
+
+	// Resolver is used to resolve the hostnames of filter list URLs.
+	Resolver *net.Resolver
+
+	// CacheDir is the path to the directory used to cache the downloaded
+	// filter lists as well as the per-list refresh metadata; see
+	// [listRefreshState].
+	CacheDir string
+
+	// CustomFilterCacheSize is the size of the LRU cache of compiled
+	// filtering engines for profiles with custom filtering rules.
+	CustomFilterCacheSize int
+
+	// SafeSearchCacheTTL is the time to live for cached safe-search results.
+	SafeSearchCacheTTL time.Duration
+
+	// RefreshIvl is the default interval between filter index refreshes.  It
+	// is also the interval at which each filter list is refreshed again
+	// after a successful refresh; see [DefaultStorage.RefreshList].
+	RefreshIvl time.Duration
+
+	// RefreshJitter is the maximum amount of time that the initial refresh of
+	// each filter list in the index is randomly delayed by, so that a large
+	// index doesn't stampede the origin on startup.
+	RefreshJitter time.Duration
+
+	// HostsFiles are the hosts-format sources whose entries are synthesized
+	// directly into A/AAAA/PTR answers, short-circuiting the rule engine and
+	// upstream resolution; see [HostsContainer].
+	HostsFiles []HostsFileConfig
+}
+
+// DefaultStorage is the default storage for filter lists, both ones from the
+// index as well as various auxiliary lists.
+type DefaultStorage struct {
+	conf *DefaultStorageConfig
+
+	// listsMu protects lists.
+	listsMu *sync.Mutex
+
+	// lists are the download URLs of the individual filter lists from the
+	// index, keyed by filter list ID.  Their refresh state is kept on disk;
+	// see [listRefreshState].
+	lists map[agd.FilterListID]string
+
+	// hosts is the hosts-file filter built from [DefaultStorageConfig.HostsFiles],
+	// or nil if none were configured.
+	hosts *HostsContainer
+}
+
+// NewDefaultStorage returns a new *DefaultStorage with the given
+// configuration.  c must not be nil and must be valid.
+func NewDefaultStorage(c *DefaultStorageConfig) (s *DefaultStorage, err error) {
+	var hosts *HostsContainer
+	if len(c.HostsFiles) > 0 {
+		confs := make([]*HostsFileConfig, len(c.HostsFiles))
+		for i := range c.HostsFiles {
+			confs[i] = &c.HostsFiles[i]
+		}
+
+		hosts = NewHostsContainer(c.Now, confs...)
+	}
+
+	return &DefaultStorage{
+		conf:    c,
+		listsMu: &sync.Mutex{},
+		lists:   map[agd.FilterListID]string{},
+		hosts:   hosts,
+	}, nil
+}
+
+// Hosts returns the hosts-file filter configured for s, or nil if none were
+// configured.
+func (s *DefaultStorage) Hosts() (hosts *HostsContainer) {
+	return s.hosts
+}
+
+// setLists replaces the current set of tracked filter lists, normally called
+// once the filter list index has been fetched and parsed.
+func (s *DefaultStorage) setLists(lists map[agd.FilterListID]string) {
+	s.listsMu.Lock()
+	defer s.listsMu.Unlock()
+
+	s.lists = lists
+}
+
+// Refresh implements the [agd.Refresher] interface for *DefaultStorage.  It
+// refreshes every tracked filter list, staggering and backing off refreshes
+// on a per-list basis; see [DefaultStorage.RefreshList].
+func (s *DefaultStorage) Refresh(ctx context.Context) (err error) {
+	s.listsMu.Lock()
+	lists := s.lists
+	s.listsMu.Unlock()
+
+	var errs []error
+	for id, srcURL := range lists {
+		_, rErr := s.RefreshList(ctx, id, srcURL)
+		if rErr != nil {
+			errs = append(errs, rErr)
+			agd.Collectf(ctx, s.conf.ErrColl, "filter: storage: refreshing list %s: %w", id, rErr)
+		}
+	}
+
+	if s.hosts != nil {
+		hErr := s.hosts.Refresh(ctx)
+		if hErr != nil {
+			errs = append(errs, hErr)
+			agd.Collectf(ctx, s.conf.ErrColl, "filter: storage: refreshing hosts files: %w", hErr)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// type check
+var _ agd.Refresher = (*DefaultStorage)(nil)
@@ -0,0 +1,437 @@
+// Package geoip contains the GeoIP database implementation used to look up
+// the country and autonomous system number (ASN) of IP addresses.
+package geoip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/agd"
+	"github.com/AdguardTeam/AdGuardDNS/internal/agdcache"
+	"github.com/AdguardTeam/AdGuardDNS/internal/metrics"
+	"github.com/AdguardTeam/golibs/log"
+	"github.com/fsnotify/fsnotify"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// geoReader is a reference-counted wrapper around a [maxminddb.Reader].  The
+// reader's mmap'd buffer must not be released while a lookup is still using
+// it, so the underlying reader is only closed once its reference count drops
+// to zero.
+//
+// A new geoReader starts with a reference count of one, representing the
+// reference held by the [atomic.Pointer] slot it's stored in; that reference
+// must be released once the reader has been swapped out.
+type geoReader struct {
+	reader *maxminddb.Reader
+	refs   atomic.Int32
+}
+
+// newGeoReader returns a new *geoReader wrapping r with a reference count of
+// one.
+func newGeoReader(r *maxminddb.Reader) (gr *geoReader) {
+	gr = &geoReader{reader: r}
+	gr.refs.Store(1)
+
+	return gr
+}
+
+// acquire attempts to take a reference on gr for the duration of a lookup.
+// It returns false if gr has already been retired and closed, in which case
+// the caller should reload the current reader and try again.
+func (gr *geoReader) acquire() (ok bool) {
+	for {
+		n := gr.refs.Load()
+		if n <= 0 {
+			return false
+		}
+
+		if gr.refs.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// release drops a reference taken by acquire or held by the owning
+// [atomic.Pointer] slot, closing the underlying reader once the last
+// reference is released.
+func (gr *geoReader) release() {
+	if gr.refs.Add(-1) == 0 {
+		_ = gr.reader.Close()
+	}
+}
+
+// statFallbackIvl is the interval at which the database files are stat'd as
+// a fallback for file systems or rename patterns that don't reliably emit
+// fsnotify events, e.g. atomic renames on some network file systems.
+const statFallbackIvl = 1 * time.Minute
+
+// FileConfig is the configuration for [File].
+type FileConfig struct {
+	// ErrColl is used to report non-fatal errors, such as a failed reload.
+	ErrColl agd.ErrorCollector
+
+	// ASNPath is the path to the ASN MaxMind database file.
+	ASNPath string
+
+	// CountryPath is the path to the country MaxMind database file.
+	CountryPath string
+
+	// HostCacheSize is the size of the LRU cache used for host-name
+	// lookups.  Zero disables the cache.
+	HostCacheSize int
+
+	// IPCacheSize is the size of the LRU cache used for IP-address lookups.
+	// Zero disables the cache.
+	IPCacheSize int
+}
+
+// File is a [agd.Refresher] and [agd.Service] that looks up the country and
+// ASN of IP addresses using local MaxMind database files, reloading them
+// whenever they're rewritten on disk.
+type File struct {
+	asn     atomic.Pointer[geoReader]
+	country atomic.Pointer[geoReader]
+
+	hostCache *agdcache.LRU[string, string]
+	ipCache   *agdcache.LRU[netip.Addr, uint32]
+
+	errColl agd.ErrorCollector
+
+	asnPath     string
+	countryPath string
+
+	asnModTime     atomic.Int64
+	countryModTime atomic.Int64
+
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+// NewFile returns a new *File that reads its databases from c.ASNPath and
+// c.CountryPath.  It loads both databases once before returning, and starts
+// a background watch for rewrites of either file; call [File.Shutdown] to stop
+// it.
+func NewFile(c *FileConfig) (f *File, err error) {
+	f = &File{
+		hostCache:   agdcache.NewLRU[string, string](c.HostCacheSize),
+		ipCache:     agdcache.NewLRU[netip.Addr, uint32](c.IPCacheSize),
+		errColl:     c.ErrColl,
+		asnPath:     c.ASNPath,
+		countryPath: c.CountryPath,
+		done:        make(chan struct{}),
+	}
+
+	err = f.reloadASN()
+	if err != nil {
+		return nil, fmt.Errorf("loading asn database: %w", err)
+	}
+
+	err = f.reloadCountry()
+	if err != nil {
+		return nil, fmt.Errorf("loading country database: %w", err)
+	}
+
+	f.watcher, err = fsnotify.NewWatcher()
+	if err != nil {
+		log.Error("geoip: fsnotify unavailable, relying on stat fallback only: %s", err)
+	} else {
+		for _, p := range []string{c.ASNPath, c.CountryPath} {
+			if wErr := f.watcher.Add(p); wErr != nil {
+				log.Error("geoip: watching %q: %s", p, wErr)
+			}
+		}
+
+		go f.watchLoop()
+	}
+
+	return f, nil
+}
+
+// type check
+var (
+	_ agd.Refresher = (*File)(nil)
+	_ agd.Service   = (*File)(nil)
+)
+
+// ASN returns the autonomous system number for ip.  It implements the
+// [github.com/AdguardTeam/AdGuardDNS/internal/websvc.ASNLookup] interface.
+func (f *File) ASN(ip netip.Addr) (asn uint32, err error) {
+	if v, ok := f.ipCache.Get(ip); ok {
+		return v, nil
+	}
+
+	r := f.acquireASN()
+	if r == nil {
+		return 0, fmt.Errorf("asn database not loaded")
+	}
+	defer r.release()
+
+	var rec struct {
+		AutonomousSystemNumber uint32 `maxminddb:"autonomous_system_number"`
+	}
+
+	err = r.reader.Lookup(net.IP(ip.AsSlice()), &rec)
+	if err != nil {
+		return 0, fmt.Errorf("looking up asn: %w", err)
+	}
+
+	f.ipCache.Set(ip, rec.AutonomousSystemNumber)
+
+	return rec.AutonomousSystemNumber, nil
+}
+
+// Country returns the ISO country code for ip, or an empty string if it
+// isn't found.
+func (f *File) Country(ip netip.Addr) (country string, err error) {
+	r := f.acquireCountry()
+	if r == nil {
+		return "", fmt.Errorf("country database not loaded")
+	}
+	defer r.release()
+
+	var rec struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+
+	err = r.reader.Lookup(net.IP(ip.AsSlice()), &rec)
+	if err != nil {
+		return "", fmt.Errorf("looking up country: %w", err)
+	}
+
+	return rec.Country.ISOCode, nil
+}
+
+// acquireASN returns the current ASN reader with an acquired reference, or
+// nil if it isn't loaded.  The caller must call release on the result once
+// it's done using it.
+func (f *File) acquireASN() (r *geoReader) {
+	for {
+		r = f.asn.Load()
+		if r == nil || r.acquire() {
+			return r
+		}
+	}
+}
+
+// acquireCountry returns the current country reader with an acquired
+// reference, or nil if it isn't loaded.  The caller must call release on the
+// result once it's done using it.
+func (f *File) acquireCountry() (r *geoReader) {
+	for {
+		r = f.country.Load()
+		if r == nil || r.acquire() {
+			return r
+		}
+	}
+}
+
+// CountryByHost resolves host and returns the ISO country code of its first
+// resolved address, using a cache keyed by hostname to avoid a DNS lookup
+// and a database query on every call.
+func (f *File) CountryByHost(ctx context.Context, host string) (country string, err error) {
+	if v, ok := f.hostCache.Get(host); ok {
+		return v, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return "", fmt.Errorf("resolving %q: %w", host, err)
+	} else if len(addrs) == 0 {
+		return "", fmt.Errorf("resolving %q: no addresses", host)
+	}
+
+	ip, err := netip.ParseAddr(addrs[0])
+	if err != nil {
+		return "", fmt.Errorf("parsing resolved address: %w", err)
+	}
+
+	country, err = f.Country(ip)
+	if err != nil {
+		return "", err
+	}
+
+	f.hostCache.Set(host, country)
+
+	return country, nil
+}
+
+// Refresh implements the [agd.Refresher] interface for *File.  It stats
+// both database files and reloads any that have changed since the last
+// check; this is the fallback path for file systems or rename patterns that
+// don't reliably emit fsnotify events.
+func (f *File) Refresh(_ context.Context) (err error) {
+	var errs []error
+
+	if f.changed(f.asnPath, &f.asnModTime) {
+		if rErr := f.reloadASN(); rErr != nil {
+			errs = append(errs, fmt.Errorf("reloading asn database: %w", rErr))
+		}
+	}
+
+	if f.changed(f.countryPath, &f.countryModTime) {
+		if rErr := f.reloadCountry(); rErr != nil {
+			errs = append(errs, fmt.Errorf("reloading country database: %w", rErr))
+		}
+	}
+
+	if len(errs) > 0 {
+		metrics.GeoIPReloadErrorsTotal.Add(float64(len(errs)))
+
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+// changed returns true if the modification time of path has changed since
+// the value stored in modTime, updating modTime as a side effect.  It
+// returns false, without updating modTime, if path can't be stat'd.
+func (f *File) changed(path string, modTime *atomic.Int64) (ok bool) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	mtime := fi.ModTime().UnixNano()
+
+	return modTime.Swap(mtime) != mtime
+}
+
+// reloadASN opens a fresh reader for the ASN database and atomically swaps
+// it in, invalidating the IP cache.  In-flight lookups using the previous
+// reader are unaffected: it's only closed once every lookup that acquired it
+// has released it.
+func (f *File) reloadASN() (err error) {
+	r, err := maxminddb.Open(f.asnPath)
+	if err != nil {
+		return err
+	}
+
+	old := f.asn.Swap(newGeoReader(r))
+	if old != nil {
+		old.release()
+	}
+
+	f.ipCache.Clear()
+	metrics.GeoIPReloadTimestamp.SetToCurrentTime()
+
+	return nil
+}
+
+// reloadCountry opens a fresh reader for the country database and
+// atomically swaps it in, invalidating the host cache.  In-flight lookups
+// using the previous reader are unaffected: it's only closed once every
+// lookup that acquired it has released it.
+func (f *File) reloadCountry() (err error) {
+	r, err := maxminddb.Open(f.countryPath)
+	if err != nil {
+		return err
+	}
+
+	old := f.country.Swap(newGeoReader(r))
+	if old != nil {
+		old.release()
+	}
+
+	f.hostCache.Clear()
+	metrics.GeoIPReloadTimestamp.SetToCurrentTime()
+
+	return nil
+}
+
+// watchLoop reacts to fsnotify events on the database files, reloading the
+// affected one, and also runs the stat-based fallback check on a timer.
+// watchLoop is intended to be run in its own goroutine.
+func (f *File) watchLoop() {
+	defer log.OnPanic("geoip: watch loop")
+
+	ticker := time.NewTicker(statFallbackIvl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev, ok := <-f.watcher.Events:
+			if !ok {
+				return
+			}
+
+			f.handleEvent(ev)
+		case err, ok := <-f.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			log.Error("geoip: watcher: %s", err)
+		case <-ticker.C:
+			if err := f.Refresh(context.Background()); err != nil {
+				agd.Collectf(context.Background(), f.errColl, "geoip: stat fallback refresh: %w", err)
+			}
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// handleEvent reloads the database affected by ev, if any.  Write, create,
+// and rename events all trigger a reload, since editors and deployment
+// tools commonly replace database files using atomic renames.
+func (f *File) handleEvent(ev fsnotify.Event) {
+	if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+		return
+	}
+
+	var err error
+	switch ev.Name {
+	case f.asnPath:
+		err = f.reloadASN()
+	case f.countryPath:
+		err = f.reloadCountry()
+	default:
+		return
+	}
+
+	if err != nil {
+		metrics.GeoIPReloadErrorsTotal.Inc()
+		agd.Collectf(context.Background(), f.errColl, "geoip: reloading %q: %w", ev.Name, err)
+	}
+
+	// Some editors and tools remove and recreate the watched file on
+	// rename, which drops the inode from the watch list; re-add it so that
+	// subsequent rewrites are still observed.
+	_ = f.watcher.Add(ev.Name)
+}
+
+// Start implements the [agd.Service] interface for *File.  The watch loop
+// is already running by the time NewFile returns, so Start is a no-op.
+func (f *File) Start(_ context.Context) (err error) {
+	return nil
+}
+
+// Shutdown implements the [agd.Service] interface for *File.  It stops the
+// background watch and closes both database readers.
+func (f *File) Shutdown(_ context.Context) (err error) {
+	close(f.done)
+
+	if f.watcher != nil {
+		_ = f.watcher.Close()
+	}
+
+	if r := f.asn.Load(); r != nil {
+		r.release()
+	}
+
+	if r := f.country.Load(); r != nil {
+		r.release()
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package geoip
+
+import (
+	"testing"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGeoReader_acquireRelease makes sure that a [geoReader] only closes its
+// underlying reader once every acquired reference has been released, and
+// that acquire refuses to hand out new references once the reader has
+// already been retired.  This is the invariant that prevents a reload from
+// closing the mmap'd database out from under an in-flight lookup.
+func TestGeoReader_acquireRelease(t *testing.T) {
+	gr := newGeoReader(&maxminddb.Reader{})
+
+	ok := gr.acquire()
+	require.True(t, ok)
+	require.EqualValues(t, 2, gr.refs.Load())
+
+	// Two references are now held: the one [newGeoReader] started with, and
+	// the one just acquired.  Releasing one of them must not close the
+	// reader yet.
+	gr.release()
+	assert.EqualValues(t, 1, gr.refs.Load())
+
+	// Releasing the last reference closes the underlying reader and retires
+	// gr, so any further acquire must fail.
+	gr.release()
+	assert.EqualValues(t, 0, gr.refs.Load())
+
+	ok = gr.acquire()
+	assert.False(t, ok)
+}
@@ -0,0 +1,159 @@
+package querylog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/agd"
+	"github.com/AdguardTeam/AdGuardDNS/internal/metrics"
+	"github.com/AdguardTeam/AdGuardDNS/internal/optlog"
+	"github.com/AdguardTeam/golibs/errors"
+)
+
+// sinkCloser is implemented by [Interface] implementations that hold
+// resources, such as a background flusher goroutine, that must be released
+// on shutdown.
+type sinkCloser interface {
+	Close() (err error)
+}
+
+// MultiSink is an [Interface] implementation that fans a single entry out to
+// several other sinks.  Writes to the underlying sinks are performed
+// concurrently, and MultiSink waits for all of them before returning.
+type MultiSink struct {
+	sinks []Interface
+}
+
+// NewMultiSink returns a new *MultiSink that fans entries out to sinks.
+// sinks must not be empty.
+func NewMultiSink(sinks ...Interface) (s *MultiSink) {
+	return &MultiSink{
+		sinks: sinks,
+	}
+}
+
+// type check
+var _ Interface = (*MultiSink)(nil)
+
+// Write implements the [Interface] interface for *MultiSink.  It writes e to
+// all underlying sinks concurrently and returns the errors of all failed
+// sinks joined together, if any, after every sink has finished.
+func (s *MultiSink) Write(ctx context.Context, e *Entry) (err error) {
+	errs := make([]error, len(s.sinks))
+
+	var wg sync.WaitGroup
+	wg.Add(len(s.sinks))
+	for i, sink := range s.sinks {
+		go func(i int, sink Interface) {
+			defer wg.Done()
+
+			errs[i] = sink.Write(ctx, e)
+		}(i, sink)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// Close closes every underlying sink that supports it.
+func (s *MultiSink) Close() (err error) {
+	var errs []error
+	for _, sink := range s.sinks {
+		if c, ok := sink.(sinkCloser); ok {
+			if cErr := c.Close(); cErr != nil {
+				errs = append(errs, cErr)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// BufferedAsyncConfig is the configuration for a [BufferedAsync] sink.
+type BufferedAsyncConfig struct {
+	// Sink is the underlying sink that actually persists entries.  It must
+	// not be nil.
+	Sink Interface
+
+	// ErrColl is used to report errors that occur while writing buffered
+	// entries.  It must not be nil.
+	ErrColl agd.ErrorCollector
+
+	// QueueSize is the maximum number of entries that can be buffered before
+	// new entries start being dropped.
+	QueueSize int
+}
+
+// BufferedAsync is an [Interface] implementation that buffers entries in a
+// bounded, in-memory queue and writes them to the underlying sink from a
+// single background goroutine.  This decouples request handling from the
+// potentially slow or bursty underlying sink, at the cost of dropping entries
+// once the queue is full.
+type BufferedAsync struct {
+	sink    Interface
+	errColl agd.ErrorCollector
+	queue   chan *Entry
+	done    chan struct{}
+}
+
+// NewBufferedAsync returns a new *BufferedAsync sink and starts its
+// background writer goroutine.  c must not be nil and must be valid.
+func NewBufferedAsync(c *BufferedAsyncConfig) (s *BufferedAsync) {
+	s = &BufferedAsync{
+		sink:    c.Sink,
+		errColl: c.ErrColl,
+		queue:   make(chan *Entry, c.QueueSize),
+		done:    make(chan struct{}),
+	}
+
+	go s.writeLoop()
+
+	return s
+}
+
+// type check
+var _ Interface = (*BufferedAsync)(nil)
+
+// Write implements the [Interface] interface for *BufferedAsync.  It never
+// blocks; if the queue is full the entry is dropped and a metric is
+// incremented.
+func (s *BufferedAsync) Write(_ context.Context, e *Entry) (err error) {
+	select {
+	case s.queue <- e:
+		metrics.QueryLogSinkQueueSize.Set(float64(len(s.queue)))
+	default:
+		metrics.QueryLogSinkDroppedTotal.Inc()
+		optlog.Debug1("querylog: buffered async: dropped entry %q, queue full", e.RequestID)
+	}
+
+	return nil
+}
+
+// Close stops the background writer goroutine, waiting for it to drain the
+// queue of already-buffered entries, and closes the underlying sink if it
+// supports it.
+func (s *BufferedAsync) Close() (err error) {
+	close(s.queue)
+	<-s.done
+
+	if c, ok := s.sink.(sinkCloser); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// writeLoop writes entries from the queue to the underlying sink until the
+// queue is closed.
+func (s *BufferedAsync) writeLoop() {
+	defer close(s.done)
+
+	ctx := context.Background()
+	for e := range s.queue {
+		err := s.sink.Write(ctx, e)
+		if err != nil {
+			s.errColl.Collect(ctx, fmt.Errorf("querylog: buffered async: writing entry: %w", err))
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package querylog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// ElasticConfig is the configuration for an [Elastic] sink.
+type ElasticConfig struct {
+	// HTTPClient is the HTTP client used to send bulk requests.  If nil,
+	// [http.DefaultClient] is used.
+	HTTPClient *http.Client
+
+	// URL is the base URL of the Elasticsearch or OpenSearch cluster, i.e.
+	// the URL whose "/_bulk" endpoint is used for indexing.
+	URL string
+
+	// IndexPrefix is the prefix used to compute the rollover index name, to
+	// which the formatted entry timestamp is appended, e.g. "adguard-dns-"
+	// produces indices like "adguard-dns-2023.10.01".
+	IndexPrefix string
+
+	// BatchSize is the maximum number of entries sent in a single bulk
+	// request.
+	BatchSize int
+
+	// FlushIvl is the maximum amount of time a partially filled batch is kept
+	// before being flushed regardless of its size.
+	FlushIvl time.Duration
+}
+
+// Elastic is a [Interface] implementation that indexes query log entries
+// into Elasticsearch or OpenSearch using the bulk NDJSON API, with indices
+// rolled over daily.
+type Elastic struct {
+	httpClient  *http.Client
+	url         string
+	indexPrefix string
+
+	mu    *sync.Mutex
+	batch []*Entry
+
+	batchSize int
+	flushIvl  time.Duration
+
+	flushSignal chan struct{}
+	stop        chan struct{}
+	stopped     chan struct{}
+}
+
+// NewElastic returns a new *Elastic sink and starts its background flusher
+// goroutine.  c must not be nil and must be valid.
+func NewElastic(c *ElasticConfig) (e *Elastic) {
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	e = &Elastic{
+		httpClient:  httpClient,
+		url:         c.URL,
+		indexPrefix: c.IndexPrefix,
+		mu:          &sync.Mutex{},
+		batch:       make([]*Entry, 0, c.BatchSize),
+		batchSize:   c.BatchSize,
+		flushIvl:    c.FlushIvl,
+		flushSignal: make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+
+	go e.flushLoop()
+
+	return e
+}
+
+// type check
+var _ Interface = (*Elastic)(nil)
+
+// Write implements the [Interface] interface for *Elastic.
+func (e *Elastic) Write(_ context.Context, ent *Entry) (err error) {
+	e.mu.Lock()
+	e.batch = append(e.batch, ent)
+	full := len(e.batch) >= e.batchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.flushSignal <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// flushLoop periodically flushes the current batch until Close is called.
+func (e *Elastic) flushLoop() {
+	defer close(e.stopped)
+
+	t := time.NewTicker(e.flushIvl)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-e.flushSignal:
+		case <-e.stop:
+			return
+		}
+
+		fErr := e.flush(context.Background())
+		if fErr != nil {
+			log.Error("querylog: elastic: flushing batch: %s", fErr)
+		}
+	}
+}
+
+// Close stops the background flusher goroutine and flushes any remaining,
+// not yet sent entries.
+func (e *Elastic) Close() (err error) {
+	close(e.stop)
+	<-e.stopped
+
+	return e.flush(context.Background())
+}
+
+// bulkIndexAction is the action-and-metadata line preceding each document in
+// a bulk request.
+type bulkIndexAction struct {
+	Index struct {
+		Index string `json:"_index"`
+	} `json:"index"`
+}
+
+// flush sends the current batch to Elasticsearch/OpenSearch as a single bulk
+// request and clears the batch.
+func (e *Elastic) flush(ctx context.Context) (err error) {
+	e.mu.Lock()
+	batch := e.batch
+	e.batch = make([]*Entry, 0, e.batchSize)
+	e.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	for _, ent := range batch {
+		act := bulkIndexAction{}
+		act.Index.Index = e.indexName(ent.Time)
+
+		err = enc.Encode(act)
+		if err != nil {
+			return fmt.Errorf("querylog: elastic: encoding action: %w", err)
+		}
+
+		err = enc.Encode(ent)
+		if err != nil {
+			return fmt.Errorf("querylog: elastic: encoding entry %q: %w", ent.RequestID, err)
+		}
+	}
+
+	return e.bulk(ctx, buf.Bytes())
+}
+
+// indexName returns the rollover index name for the given entry timestamp.
+func (e *Elastic) indexName(t time.Time) (name string) {
+	return e.indexPrefix + t.UTC().Format("2006.01.02")
+}
+
+// bulk sends a single, already-encoded NDJSON payload to the cluster's bulk
+// endpoint.
+func (e *Elastic) bulk(ctx context.Context, body []byte) (err error) {
+	r, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		e.url+"/_bulk",
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return fmt.Errorf("querylog: elastic: creating request: %w", err)
+	}
+
+	r.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := e.httpClient.Do(r)
+	if err != nil {
+		return fmt.Errorf("querylog: elastic: sending request: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("querylog: elastic: unexpected status code %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return fmt.Errorf("querylog: elastic: decoding response: %w", err)
+	}
+
+	if result.Errors {
+		return fmt.Errorf("querylog: elastic: bulk request reported per-item errors")
+	}
+
+	return nil
+}
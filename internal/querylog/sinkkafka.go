@@ -0,0 +1,74 @@
+package querylog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// KafkaConfig is the configuration for a [Kafka] sink.
+type KafkaConfig struct {
+	// Brokers is the list of "host:port" addresses of the Kafka brokers to
+	// bootstrap from.
+	Brokers []string
+
+	// Topic is the Kafka topic to which entries are produced.
+	Topic string
+
+	// RequiredAcks controls how many broker acknowledgements the producer
+	// waits for before considering a write successful, e.g.
+	// kafka.RequireAll, kafka.RequireOne, or kafka.RequireNone.
+	RequiredAcks kafka.RequiredAcks
+
+	// Compression is the compression codec used for produced messages.
+	Compression kafka.Compression
+}
+
+// Kafka is a [Interface] implementation that produces query log entries as
+// JSON-encoded Kafka messages, partitioned by ProfileID so that all entries
+// for a given profile land on the same partition and preserve order.
+type Kafka struct {
+	writer *kafka.Writer
+}
+
+// NewKafka returns a new *Kafka sink.  c must not be nil and must be valid.
+func NewKafka(c *KafkaConfig) (k *Kafka) {
+	return &Kafka{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(c.Brokers...),
+			Topic:        c.Topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: c.RequiredAcks,
+			Compression:  c.Compression,
+		},
+	}
+}
+
+// type check
+var _ Interface = (*Kafka)(nil)
+
+// Write implements the [Interface] interface for *Kafka.  It uses
+// e.ProfileID as the partition key.
+func (k *Kafka) Write(ctx context.Context, e *Entry) (err error) {
+	val, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("querylog: kafka: marshaling entry %q: %w", e.RequestID, err)
+	}
+
+	err = k.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(e.ProfileID),
+		Value: val,
+	})
+	if err != nil {
+		return fmt.Errorf("querylog: kafka: producing entry %q: %w", e.RequestID, err)
+	}
+
+	return nil
+}
+
+// Close closes the underlying Kafka writer, flushing any buffered messages.
+func (k *Kafka) Close() (err error) {
+	return k.writer.Close()
+}
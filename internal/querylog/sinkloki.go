@@ -0,0 +1,277 @@
+package querylog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/AdguardTeam/golibs/log"
+)
+
+// LokiConfig is the configuration for a [Loki] sink.
+type LokiConfig struct {
+	// HTTPClient is the HTTP client used to push log streams.  If nil,
+	// [http.DefaultClient] is used.
+	HTTPClient *http.Client
+
+	// URL is the address of the Loki push API, i.e. the URL of the
+	// "/loki/api/v1/push" endpoint.
+	URL string
+
+	// TenantID is the value sent in the "X-Scope-OrgID" header.  It is
+	// omitted if empty.
+	TenantID string
+
+	// BatchSize is the maximum number of entries sent in a single push
+	// request.
+	BatchSize int
+
+	// FlushIvl is the maximum amount of time a partially filled batch is kept
+	// before being flushed regardless of its size.
+	FlushIvl time.Duration
+
+	// MaxRetries is the maximum number of retries performed for a single
+	// batch before it is dropped.
+	MaxRetries int
+}
+
+// Loki is a [Interface] implementation that pushes query log entries to
+// Grafana Loki as a single log stream per ProfileID.
+//
+// TODO(a.garipov): Consider extracting the generic batching logic into a
+// separate type shared with other HTTP-based sinks, should more appear.
+type Loki struct {
+	httpClient *http.Client
+	url        string
+	tenantID   string
+
+	mu    *sync.Mutex
+	batch []*Entry
+
+	batchSize  int
+	flushIvl   time.Duration
+	maxRetries int
+
+	flushSignal chan struct{}
+	stop        chan struct{}
+	stopped     chan struct{}
+}
+
+// NewLoki returns a new *Loki sink and starts its background flusher
+// goroutine.  c must not be nil and must be valid.
+func NewLoki(c *LokiConfig) (l *Loki) {
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	l = &Loki{
+		httpClient:  httpClient,
+		url:         c.URL,
+		tenantID:    c.TenantID,
+		mu:          &sync.Mutex{},
+		batch:       make([]*Entry, 0, c.BatchSize),
+		batchSize:   c.BatchSize,
+		flushIvl:    c.FlushIvl,
+		maxRetries:  c.MaxRetries,
+		flushSignal: make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+
+	go l.flushLoop()
+
+	return l
+}
+
+// type check
+var _ Interface = (*Loki)(nil)
+
+// Write implements the [Interface] interface for *Loki.  It appends e to the
+// current batch and triggers a flush once the batch is full.
+func (l *Loki) Write(_ context.Context, e *Entry) (err error) {
+	l.mu.Lock()
+	l.batch = append(l.batch, e)
+	full := len(l.batch) >= l.batchSize
+	l.mu.Unlock()
+
+	if full {
+		select {
+		case l.flushSignal <- struct{}{}:
+		default:
+			// A flush is already pending.
+		}
+	}
+
+	return nil
+}
+
+// flushLoop periodically flushes the current batch, either because it is
+// full or because flushIvl has elapsed, until Close is called.
+func (l *Loki) flushLoop() {
+	defer close(l.stopped)
+
+	t := time.NewTicker(l.flushIvl)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-l.flushSignal:
+		case <-l.stop:
+			return
+		}
+
+		err := l.flush(context.Background())
+		if err != nil {
+			log.Error("querylog: loki: flushing batch: %s", err)
+		}
+	}
+}
+
+// Close stops the background flusher goroutine and flushes any remaining,
+// not yet sent entries.
+func (l *Loki) Close() (err error) {
+	close(l.stop)
+	<-l.stopped
+
+	return l.flush(context.Background())
+}
+
+// flush sends the current batch to Loki, retrying with full jitter on
+// failure, and clears the batch.
+func (l *Loki) flush(ctx context.Context) (err error) {
+	l.mu.Lock()
+	batch := l.batch
+	l.batch = make([]*Entry, 0, l.batchSize)
+	l.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	body, err := l.encode(batch)
+	if err != nil {
+		return fmt.Errorf("querylog: loki: encoding batch: %w", err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= l.maxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(fullJitterBackoff(attempt))
+		}
+
+		lastErr = l.push(ctx, body)
+		if lastErr == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("querylog: loki: giving up after %d attempts: %w", l.maxRetries+1, lastErr)
+}
+
+// lokiStream is the push-request payload format expected by Loki.
+type lokiStream struct {
+	Labels  map[string]string `json:"stream"`
+	Entries [][2]string       `json:"values"`
+}
+
+// lokiPushRequest is the top-level push-request payload.
+type lokiPushRequest struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+// encode serializes batch grouped by ProfileID into a gzip-compressed Loki
+// push request.
+func (l *Loki) encode(batch []*Entry) (body []byte, err error) {
+	byProfile := map[string][][2]string{}
+	for _, e := range batch {
+		ts := strconv.FormatInt(e.Time.UnixNano(), 10)
+
+		line, mErr := json.Marshal(e)
+		if mErr != nil {
+			return nil, fmt.Errorf("marshaling entry %q: %w", e.RequestID, mErr)
+		}
+
+		pID := string(e.ProfileID)
+		byProfile[pID] = append(byProfile[pID], [2]string{ts, string(line)})
+	}
+
+	req := lokiPushRequest{
+		Streams: make([]lokiStream, 0, len(byProfile)),
+	}
+	for pID, entries := range byProfile {
+		req.Streams = append(req.Streams, lokiStream{
+			Labels:  map[string]string{"profile_id": pID, "job": "adguard-dns"},
+			Entries: entries,
+		})
+	}
+
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling push request: %w", err)
+	}
+
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, err = gz.Write(raw)
+	if err != nil {
+		return nil, fmt.Errorf("gzipping push request: %w", err)
+	}
+
+	err = gz.Close()
+	if err != nil {
+		return nil, fmt.Errorf("closing gzip writer: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// push sends a single, already-encoded push request to Loki.
+func (l *Loki) push(ctx context.Context, body []byte) (err error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, l.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Encoding", "gzip")
+	if l.tenantID != "" {
+		r.Header.Set("X-Scope-OrgID", l.tenantID)
+	}
+
+	resp, err := l.httpClient.Do(r)
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer func() { err = errors.WithDeferred(err, resp.Body.Close()) }()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// fullJitterBackoff returns a randomized backoff duration for the given retry
+// attempt, using the full-jitter strategy: a uniform random value between
+// zero and an exponentially growing cap.
+func fullJitterBackoff(attempt int) (d time.Duration) {
+	const base = 200 * time.Millisecond
+	const max = 30 * time.Second
+
+	cap := base * time.Duration(1<<uint(attempt))
+	if cap > max || cap <= 0 {
+		cap = max
+	}
+
+	return time.Duration(rand.Int63n(int64(cap)))
+}
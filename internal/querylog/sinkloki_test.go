@@ -0,0 +1,43 @@
+package querylog_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/querylog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoki_Close makes sure that Close flushes any entries still sitting in
+// the batch instead of dropping them, and that it actually waits for the
+// background flusher goroutine to stop.
+func TestLoki_Close(t *testing.T) {
+	var pushes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		pushes.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	l := querylog.NewLoki(&querylog.LokiConfig{
+		URL: srv.URL,
+		// A long flush interval makes sure the entry below would never be
+		// flushed on its own before the test times out; only Close should
+		// cause it to be sent.
+		FlushIvl:  1 * time.Hour,
+		BatchSize: 10,
+	})
+
+	err := l.Write(context.Background(), &querylog.Entry{})
+	require.NoError(t, err)
+
+	err = l.Close()
+	require.NoError(t, err)
+
+	assert.EqualValues(t, 1, pushes.Load())
+}
@@ -0,0 +1,155 @@
+package websvc
+
+import (
+	"net/http"
+	"net/netip"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/agdcache"
+	"github.com/AdguardTeam/AdGuardDNS/internal/agdhttp"
+	"github.com/AdguardTeam/AdGuardDNS/internal/optlog"
+	"golang.org/x/time/rate"
+)
+
+// Linked IP Access Control
+
+// maxLimiters is the maximum number of per-source-IP rate limiters [Access]
+// keeps around at once.  Once the limit is reached, the least recently used
+// limiter is evicted to make room for a new source IP, bounding the memory
+// a flood of distinct source addresses can make [Access] retain.
+const maxLimiters = 100_000
+
+// ASNLookup resolves the autonomous system number of an IP address.  The
+// GeoIP implementations in this module satisfy this interface.
+type ASNLookup interface {
+	ASN(ip netip.Addr) (asn uint32, err error)
+}
+
+// AccessConfig is the configuration for [Access].
+type AccessConfig struct {
+	// ASN, if set, is used to look up the ASN of incoming requests so that
+	// they can be matched against BlockedASN.
+	ASN ASNLookup
+
+	// Allowed are the CIDR prefixes that are allowed to reach the linked-IP
+	// endpoints.  If non-empty, any address that doesn't match one of these
+	// is denied, regardless of Blocked and BlockedASN.
+	Allowed []netip.Prefix
+
+	// Blocked are the CIDR prefixes that are denied access.
+	Blocked []netip.Prefix
+
+	// BlockedASN are the autonomous system numbers that are denied access.
+	BlockedASN []uint32
+
+	// RateLimitRPS is the steady-state number of requests per second allowed
+	// per source IP address.
+	RateLimitRPS float64
+
+	// RateLimitBurst is the maximum burst size allowed per source IP
+	// address.
+	RateLimitBurst int
+}
+
+// denyReason is the reason a request was denied by [Access.Allow], used as
+// the "reason" label for the denial metric.
+type denyReason string
+
+// Deny reasons.
+const (
+	denyReasonNotAllowed denyReason = "not_allowed"
+	denyReasonBlockedNet denyReason = "blocked_net"
+	denyReasonBlockedASN denyReason = "blocked_asn"
+	denyReasonRateLimit  denyReason = "rate_limit"
+)
+
+// Access is the access-control layer for the linked-IP and DDNS endpoints.
+// It supports allow/deny CIDR lists, blocked ASNs, and a per-source-IP
+// token-bucket rate limiter.
+type Access struct {
+	asn ASNLookup
+
+	allowed []netip.Prefix
+	blocked []netip.Prefix
+
+	blockedASN map[uint32]struct{}
+
+	limiters     *agdcache.LRU[netip.Addr, *rate.Limiter]
+	rps          rate.Limit
+	burst        int
+	rateLimitOff bool
+}
+
+// NewAccess returns a new *Access using the given configuration.  c must not
+// be nil.
+func NewAccess(c *AccessConfig) (a *Access) {
+	blockedASN := make(map[uint32]struct{}, len(c.BlockedASN))
+	for _, asn := range c.BlockedASN {
+		blockedASN[asn] = struct{}{}
+	}
+
+	return &Access{
+		asn:          c.ASN,
+		allowed:      c.Allowed,
+		blocked:      c.Blocked,
+		blockedASN:   blockedASN,
+		limiters:     agdcache.NewLRU[netip.Addr, *rate.Limiter](maxLimiters),
+		rps:          rate.Limit(c.RateLimitRPS),
+		burst:        c.RateLimitBurst,
+		rateLimitOff: c.RateLimitRPS <= 0 || c.RateLimitBurst <= 0,
+	}
+}
+
+// Allow returns true if a request from ip should be allowed to reach the
+// proxied backend.  If it returns false, reason describes why, for use in
+// metrics and logging.
+func (a *Access) Allow(ip netip.Addr) (ok bool, reason denyReason) {
+	if len(a.allowed) > 0 && !prefixesContain(a.allowed, ip) {
+		return false, denyReasonNotAllowed
+	}
+
+	if prefixesContain(a.blocked, ip) {
+		return false, denyReasonBlockedNet
+	}
+
+	if a.asn != nil && len(a.blockedASN) > 0 {
+		asn, err := a.asn.ASN(ip)
+		if err == nil {
+			if _, blocked := a.blockedASN[asn]; blocked {
+				return false, denyReasonBlockedASN
+			}
+		}
+	}
+
+	if !a.rateLimitOff && !a.limiterFor(ip).Allow() {
+		return false, denyReasonRateLimit
+	}
+
+	return true, ""
+}
+
+// limiterFor returns the rate limiter for the given source IP, creating one
+// if this is the first time ip is seen, and evicting the least recently used
+// limiter if [Access] is tracking too many distinct source IPs already.
+func (a *Access) limiterFor(ip netip.Addr) (l *rate.Limiter) {
+	return a.limiters.GetOrStore(ip, rate.NewLimiter(a.rps, a.burst))
+}
+
+// prefixesContain returns true if any of prefixes contains ip.
+func prefixesContain(prefixes []netip.Prefix, ip netip.Addr) (ok bool) {
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serveDenied writes a 403 Forbidden response for a request denied by
+// [Access.Allow].
+func serveDenied(w http.ResponseWriter, logPrefix string) {
+	w.Header().Set(agdhttp.HdrNameServer, agdhttp.UserAgent())
+	http.Error(w, "access denied", http.StatusForbidden)
+
+	optlog.Debug1("%s: denied by access control", logPrefix)
+}
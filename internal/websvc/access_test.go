@@ -0,0 +1,43 @@
+package websvc_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/AdguardTeam/AdGuardDNS/internal/websvc"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAccess_Allow_rateLimit makes sure that the per-source-IP rate limiter
+// actually denies requests once a source IP exceeds its burst, and that
+// leaving RateLimitRPS/RateLimitBurst unset disables rate limiting entirely
+// instead of denying every request.
+func TestAccess_Allow_rateLimit(t *testing.T) {
+	ip := netip.MustParseAddr("1.2.3.4")
+
+	t.Run("enforced", func(t *testing.T) {
+		a := websvc.NewAccess(&websvc.AccessConfig{
+			RateLimitRPS:   1,
+			RateLimitBurst: 2,
+		})
+
+		ok, _ := a.Allow(ip)
+		assert.True(t, ok)
+
+		ok, _ = a.Allow(ip)
+		assert.True(t, ok)
+
+		ok, reason := a.Allow(ip)
+		assert.False(t, ok)
+		assert.NotEmpty(t, reason)
+	})
+
+	t.Run("unconfigured_is_unlimited", func(t *testing.T) {
+		a := websvc.NewAccess(&websvc.AccessConfig{})
+
+		for i := 0; i < 10; i++ {
+			ok, _ := a.Allow(ip)
+			assert.True(t, ok)
+		}
+	})
+}
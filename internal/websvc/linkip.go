@@ -5,12 +5,14 @@ import (
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"net/netip"
 	"net/url"
 	"strings"
 	"time"
 
 	"github.com/AdguardTeam/AdGuardDNS/internal/agd"
 	"github.com/AdguardTeam/AdGuardDNS/internal/agdhttp"
+	"github.com/AdguardTeam/AdGuardDNS/internal/metrics"
 	"github.com/AdguardTeam/AdGuardDNS/internal/optlog"
 	"github.com/AdguardTeam/golibs/log"
 	"github.com/AdguardTeam/golibs/netutil"
@@ -22,34 +24,24 @@ import (
 type linkedIPProxy struct {
 	httpProxy *httputil.ReverseProxy
 	errColl   agd.ErrorCollector
+	access    *Access
 	logPrefix string
 }
 
-// linkedIPHandler returns a linked IP proxy handler.
+// linkedIPHandler returns a linked IP proxy handler.  upstreamConf is
+// optional and configures how the backend at apiURL is reached; see
+// [LinkedIPUpstreamConfig].  access is optional and, if set, is consulted
+// before every proxied request.
 func linkedIPHandler(
 	apiURL *url.URL,
 	errColl agd.ErrorCollector,
 	name string,
 	timeout time.Duration,
-) (h http.Handler) {
+	upstreamConf *LinkedIPUpstreamConfig,
+	access *Access,
+) (h http.Handler, err error) {
 	logPrefix := fmt.Sprintf("websvc: linked ip proxy %s", name)
 
-	// Use a custom Director to make sure we send the correct Host header and
-	// don't send anything besides the path.
-	director := func(r *http.Request) {
-		r.URL.Scheme = apiURL.Scheme
-		r.Host, r.URL.Host = apiURL.Host, apiURL.Host
-
-		hdr := r.Header
-
-		// Set the X-Forwarded-For header to a nil value to make sure that
-		// the proxy doesn't add it automatically.
-		hdr["X-Forwarded-For"] = nil
-
-		// Make sure that all requests are marked with our user agent.
-		hdr.Set(agdhttp.HdrNameUserAgent, agdhttp.UserAgent())
-	}
-
 	// Use largely the same transport as http.DefaultTransport, but with a
 	// couple of limits and timeouts changed.
 	//
@@ -58,7 +50,7 @@ func linkedIPHandler(
 	//
 	// TODO(e.burkov): Consider using the same transport for all the linked IP
 	// handlers.
-	transport := &http.Transport{
+	baseTransport := &http.Transport{
 		DialContext: (&net.Dialer{
 			Timeout:   timeout,
 			KeepAlive: 30 * time.Second,
@@ -70,6 +62,27 @@ func linkedIPHandler(
 		ExpectContinueTimeout: 1 * time.Second,
 	}
 
+	transport, effectiveURL, err := newLinkedIPTransport(apiURL, upstreamConf, baseTransport)
+	if err != nil {
+		return nil, fmt.Errorf("%s: setting up transport: %w", logPrefix, err)
+	}
+
+	// Use a custom Director to make sure we send the correct Host header and
+	// don't send anything besides the path.
+	director := func(r *http.Request) {
+		r.URL.Scheme = effectiveURL.Scheme
+		r.Host, r.URL.Host = effectiveURL.Host, effectiveURL.Host
+
+		hdr := r.Header
+
+		// Set the X-Forwarded-For header to a nil value to make sure that
+		// the proxy doesn't add it automatically.
+		hdr["X-Forwarded-For"] = nil
+
+		// Make sure that all requests are marked with our user agent.
+		hdr.Set(agdhttp.HdrNameUserAgent, agdhttp.UserAgent())
+	}
+
 	// Delete the Server header value from the upstream.
 	modifyResponse := func(r *http.Response) (err error) {
 		r.Header.Del(agdhttp.HdrNameServer)
@@ -97,8 +110,9 @@ func linkedIPHandler(
 			ErrorHandler:   errHdlr,
 		},
 		errColl:   errColl,
+		access:    access,
 		logPrefix: logPrefix,
-	}
+	}, nil
 }
 
 // type check
@@ -138,6 +152,24 @@ func (prx *linkedIPProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if prx.access != nil {
+			addr, aErr := netip.ParseAddr(ip)
+			if aErr != nil {
+				prx.errColl.Collect(r.Context(), fmt.Errorf("%s: parsing ip: %w", prx.logPrefix, aErr))
+
+				http.Error(w, aErr.Error(), http.StatusInternalServerError)
+
+				return
+			}
+
+			if allowed, reason := prx.access.Allow(addr); !allowed {
+				metrics.WebSvcLinkedIPDeniedTotal.WithLabelValues(string(reason)).Inc()
+				serveDenied(w, prx.logPrefix)
+
+				return
+			}
+		}
+
 		hdr.Set("CF-Connecting-IP", ip)
 
 		// Set the request ID.
@@ -0,0 +1,207 @@
+package websvc
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AdguardTeam/dnsproxy/upstream"
+	"github.com/AdguardTeam/golibs/errors"
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+)
+
+// Linked IP Upstream Transport
+
+// LinkedIPUpstreamConfig is the configuration for the transport used to
+// reach the linked-IP backend API.  It allows resolving the backend's
+// hostname via an encrypted (DoH/DoT/DoQ) bootstrap resolver, and allows the
+// backend itself to be reached over HTTP/2 cleartext (h2c) or HTTP/3 (h3).
+type LinkedIPUpstreamConfig struct {
+	// Bootstrap are the addresses of the upstream DNS servers used to resolve
+	// the backend's hostname.  Each one is either a plain "host:port" or an
+	// encrypted DNS URL understood by [upstream.AddressToUpstream], e.g.
+	// "tls://dns.example.com", "https://dns.example.com/dns-query", or
+	// "quic://dns.example.com".  If empty, the system resolver is used.  Not
+	// supported together with the "h3://" backend URL scheme; configuring
+	// both is an error.
+	Bootstrap []string
+
+	// SNI, if set, overrides the TLS server name sent to the backend.
+	SNI string
+
+	// EnableHTTP3 marks the backend as reached over HTTP/3.  The "h3://"
+	// backend URL scheme selects HTTP/3 on its own, whether EnableHTTP3 is
+	// set or not; setting EnableHTTP3 with any other scheme is an error.
+	EnableHTTP3 bool
+
+	// Timeout is the timeout used both for bootstrap resolution and for
+	// dialing the backend through the bootstrap resolvers.  It is only used
+	// if Bootstrap is set.
+	Timeout time.Duration
+}
+
+// linkedIPSchemeH2C and linkedIPSchemeH3 are the pseudo-schemes used in the
+// configured backend URL to select a non-default transport.  They are
+// rewritten to "http"/"https" before the request is sent.
+const (
+	linkedIPSchemeH2C = "h2c"
+	linkedIPSchemeH3  = "h3"
+)
+
+// newLinkedIPTransport returns an [http.RoundTripper] configured according to
+// c as well as the effective apiURL that the proxy's Director should use,
+// that is, apiURL with any pseudo-scheme rewritten to a real one.  c may be
+// nil, in which case a reasonable default transport is returned.
+func newLinkedIPTransport(
+	apiURL *url.URL,
+	c *LinkedIPUpstreamConfig,
+	baseTransport *http.Transport,
+) (rt http.RoundTripper, effectiveURL *url.URL, err error) {
+	effectiveURL = apiURL
+
+	if c == nil {
+		return baseTransport, effectiveURL, nil
+	}
+
+	dialCtx := baseTransport.DialContext
+	if len(c.Bootstrap) > 0 {
+		dialCtx, err = bootstrappedDialContext(c.Bootstrap, c.Timeout)
+		if err != nil {
+			return nil, nil, fmt.Errorf("setting up bootstrap resolver: %w", err)
+		}
+	}
+
+	baseTransport.DialContext = dialCtx
+	if c.SNI != "" {
+		baseTransport.TLSClientConfig = &tls.Config{
+			ServerName: c.SNI,
+		}
+	}
+
+	switch apiURL.Scheme {
+	case linkedIPSchemeH2C:
+		u := *apiURL
+		u.Scheme = "http"
+		effectiveURL = &u
+
+		return &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(
+				ctx context.Context,
+				network, addr string,
+				_ *tls.Config,
+			) (net.Conn, error) {
+				return dialCtx(ctx, network, addr)
+			},
+		}, effectiveURL, nil
+	case linkedIPSchemeH3:
+		if len(c.Bootstrap) > 0 {
+			return nil, nil, fmt.Errorf(
+				"bootstrap resolution is not supported for the %q url scheme",
+				linkedIPSchemeH3,
+			)
+		}
+
+		u := *apiURL
+		u.Scheme = "https"
+		effectiveURL = &u
+
+		rt = &http3.RoundTripper{
+			TLSClientConfig: baseTransport.TLSClientConfig,
+		}
+
+		return rt, effectiveURL, nil
+	default:
+		if c.EnableHTTP3 {
+			return nil, nil, fmt.Errorf("http3 requires the %q url scheme", linkedIPSchemeH3)
+		}
+
+		err = http2.ConfigureTransport(baseTransport)
+		if err != nil {
+			return nil, nil, fmt.Errorf("configuring http2: %w", err)
+		}
+
+		return baseTransport, effectiveURL, nil
+	}
+}
+
+// bootstrappedDialContext returns a dial function that resolves hostnames
+// using the given bootstrap DNS upstreams instead of the system resolver.
+// IP addresses are dialed unchanged.
+func bootstrappedDialContext(
+	bootstrap []string,
+	timeout time.Duration,
+) (dialCtx func(ctx context.Context, network, addr string) (net.Conn, error), err error) {
+	ups := make([]upstream.Upstream, 0, len(bootstrap))
+	for _, b := range bootstrap {
+		var u upstream.Upstream
+		u, err = upstream.AddressToUpstream(b, &upstream.Options{Timeout: timeout})
+		if err != nil {
+			return nil, fmt.Errorf("bootstrap resolver %q: %w", b, err)
+		}
+
+		ups = append(ups, u)
+	}
+
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+
+	return func(ctx context.Context, network, addr string) (conn net.Conn, err error) {
+		host, port, sErr := net.SplitHostPort(addr)
+		if sErr != nil {
+			return nil, fmt.Errorf("splitting host:port: %w", sErr)
+		}
+
+		if net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		ip, rErr := resolveWithUpstreams(ups, host)
+		if rErr != nil {
+			return nil, fmt.Errorf("resolving %q: %w", host, rErr)
+		}
+
+		return dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+	}, nil
+}
+
+// resolveWithUpstreams queries each of ups in turn for host's A and AAAA
+// records, returning the first address found.
+func resolveWithUpstreams(ups []upstream.Upstream, host string) (ip net.IP, err error) {
+	fqdn := host
+	if !strings.HasSuffix(fqdn, ".") {
+		fqdn += "."
+	}
+
+	var errs []error
+	for _, qType := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		for _, u := range ups {
+			req := &dns.Msg{}
+			req.SetQuestion(fqdn, qType)
+
+			resp, rErr := u.Exchange(req)
+			if rErr != nil {
+				errs = append(errs, rErr)
+
+				continue
+			}
+
+			for _, rr := range resp.Answer {
+				switch v := rr.(type) {
+				case *dns.A:
+					return v.A, nil
+				case *dns.AAAA:
+					return v.AAAA, nil
+				}
+			}
+		}
+	}
+
+	return nil, errors.Join(errs...)
+}
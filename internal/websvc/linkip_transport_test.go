@@ -0,0 +1,53 @@
+package websvc
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewLinkedIPTransport_h3Bootstrap makes sure that configuring a
+// bootstrap resolver together with the "h3://" backend URL scheme is
+// rejected explicitly, since HTTP/3's QUIC dialer doesn't go through
+// [bootstrappedDialContext].
+func TestNewLinkedIPTransport_h3Bootstrap(t *testing.T) {
+	apiURL := &url.URL{Scheme: linkedIPSchemeH3, Host: "backend.example.com"}
+	c := &LinkedIPUpstreamConfig{
+		Bootstrap: []string{"tls://dns.example.com"},
+	}
+
+	_, _, err := newLinkedIPTransport(apiURL, c, &http.Transport{})
+	assert.Error(t, err)
+}
+
+// TestNewLinkedIPTransport_h3 makes sure that the "h3://" backend URL scheme
+// selects an HTTP/3 round-tripper and rewrites the scheme to "https" when no
+// bootstrap resolver is configured.
+func TestNewLinkedIPTransport_h3(t *testing.T) {
+	apiURL := &url.URL{Scheme: linkedIPSchemeH3, Host: "backend.example.com"}
+	c := &LinkedIPUpstreamConfig{}
+
+	rt, effectiveURL, err := newLinkedIPTransport(apiURL, c, &http.Transport{})
+	require.NoError(t, err)
+
+	_, ok := rt.(*http3.RoundTripper)
+	assert.True(t, ok)
+	assert.Equal(t, "https", effectiveURL.Scheme)
+}
+
+// TestNewLinkedIPTransport_nilConfig makes sure that a nil
+// [LinkedIPUpstreamConfig] falls back to the given base transport unchanged.
+func TestNewLinkedIPTransport_nilConfig(t *testing.T) {
+	apiURL := &url.URL{Scheme: "https", Host: "backend.example.com"}
+	base := &http.Transport{}
+
+	rt, effectiveURL, err := newLinkedIPTransport(apiURL, nil, base)
+	require.NoError(t, err)
+
+	assert.Same(t, base, rt)
+	assert.Same(t, apiURL, effectiveURL)
+}